@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/practice/multi_cluster_informer/pkg"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"github.com/practice/multi_cluster_informer/pkg/metrics"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
 	"github.com/practice/multi_cluster_informer/pkg/queue"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
 	"time"
 )
 
@@ -32,47 +41,74 @@ func main() {
 	//}
 
 	// 推荐如下方式，调用者只需要关心配置文件中的设置即可
+	// 0. 进程内没有其他指标时，在 /metrics 中加入 workqueue、Go 运行时与进程指标，需在创建控制器之前调用
+	metrics.RegisterWorkqueueProvider()
+	metrics.RegisterRuntimeCollectors()
 	// 1. 获取控制器对象
-	r, err := multi_informer.NewMultiClusterInformerFromConfig("./config.yaml")
+	// 停止时最多等待 30s 让正在处理的对象完成
+	r, err := multi_informer.NewMultiClusterInformerFromConfig("./config.yaml", controller.WithDrainTimeout(30*time.Second))
 	if err != nil {
 		klog.Fatal("multi cluster informer err: ", err)
 	}
-	// 2. 加入handler
-	r.AddEventHandler(func(object queue.QueueObject) error {
-		// 判断只有add事件
-		if object.Event == queue.EventAdd {
-			fmt.Println("目前监听到事件为add的资源对象", object.ResourceType)
-		}
-		//fmt.Println("目前监听到的资源对象", obj.ResourceType, obj.Event)
-		//// 判断只有cluster2集群的事件
-		if object.ClusterName == "cluster1" {
-			fmt.Println("目前监听到集群为cluster1的资源对象", object.ResourceType)
-		}
-
-		if object.ClusterName == "cluster2" {
-			fmt.Println("目前监听到集群为cluster2的资源对象", object.ResourceType)
-		}
-
+	// 2. 加入handler与中间件
+	// Tracing 放在最外层，Recover 转换后的错误会记录在 span 中；Timeout 内部的 panic 同样会被转换为错误
+	r.Use(controller.Tracing(), controller.Recover(), controller.Logging(), controller.Timeout(10*time.Second))
+	// 全局断言：入队前过滤，被过滤的事件不会占用队列
+	r.AddEventFilter(predicate.Not(predicate.NamespaceMatches(regexp.MustCompile(`^kube-`))))
+	// 只处理add事件
+	r.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		// ctx 中的 logger 已带有 cluster、resource、key、event、handler 字段
+		controller.LoggerFrom(ctx).Info("目前监听到事件为add的资源对象")
+		return nil
+	}, predicate.EventTypeIn(queue.EventAdd))
+	// 只处理带有 env=prod 标签的集群的事件，不需要写死集群名
+	r.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		fmt.Println("目前监听到集群为", object.ClusterName, object.ClusterLabels, "的资源对象", object.ResourceType)
+		return nil
+	}, predicate.ClusterSelector(labels.SelectorFromSet(labels.Set{"env": "prod"})))
+	r.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
 		fmt.Println(time.Now(), object.Event, object.ResourceType, object.Key, object.ClusterName)
-		if object.ResourceType == queue.Pods {
-			if object.Obj != nil {
-				pp := object.Obj.(*v1.Pod)
-				fmt.Println("名字！！", pp.Name)
-			}
+		if object.Obj != nil {
+			pp := object.Obj.(*v1.Pod)
+			fmt.Println("名字！！", pp.Name)
 		}
 		return nil
-	})
+	}, predicate.ResourceIn(queue.Pods))
+
+	// 也可以使用调和器，只关心"哪个集群的哪个对象变了"，同一对象的多个事件合并为一次调和
+	r.AddReconciler(controller.ReconcileFunc(func(ctx context.Context, req controller.Request) (controller.Result, error) {
+		return reconcilePod(r, req)
+	}))
 
-	// 3. 执行informer监听
-	go r.Run()
+	// 3. 执行informer监听，收到退出信号时停止
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		if err := r.Run(ctx); err != nil {
+			klog.Error("multi cluster informer run err: ", err)
+		}
+	}()
 	defer r.Stop()
 
-	// 4. 不断从队列取出资源对象
+	// 4. 不断从队列取出资源对象，队列关闭后退出
 	for {
-		obj, _ := r.Pop()
+		obj, err := r.Pop()
+		if err != nil {
+			return
+		}
 		// 方法一：使用handler
 		// 如果自己的业务逻辑发生问题，可以重新放回队列。
 		if err = r.HandleObject(obj); err != nil {
+			// handler 明确指定了重试时间
+			if d, ok := queue.IsRetryAfter(err); ok {
+				_ = r.ReQueueAfter(obj, d)
+				continue
+			}
+			// 不可重试的错误
+			if queue.IsPermanent(err) {
+				r.Finish(obj)
+				continue
+			}
 			_ = r.ReQueue(obj) // 重新入列
 		} else { // 完成就结束
 			r.Finish(obj)
@@ -88,6 +124,25 @@ func main() {
 
 }
 
+// reconcilePod 从本地缓存读取对象当前状态，而不是依赖事件中的对象
+func reconcilePod(store queue.Store, req controller.Request) (controller.Result, error) {
+	if req.Resource != queue.Pods {
+		return controller.Result{}, nil
+	}
+	item, exists := store.GetByClusterKey(req.Cluster, req.Resource, req.Key())
+	if !exists {
+		fmt.Println("pod已被删除", req.Cluster, req.Key())
+		return controller.Result{}, nil
+	}
+	pod := item.(*v1.Pod)
+	if pod.Status.Phase == v1.PodPending {
+		// 过一会再检查
+		return controller.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	fmt.Println("pod状态", req.Cluster, req.Key(), pod.Status.Phase)
+	return controller.Result{}, nil
+}
+
 // process 执行自己的业务逻辑
 func process(obj queue.QueueObject) error {
 
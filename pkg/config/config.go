@@ -1,11 +1,10 @@
 package config
 
 import (
-	"fmt"
-	"github.com/go-yaml/yaml"
 	"github.com/practice/multi_cluster_informer/pkg/controller"
-	"io/ioutil"
-	"log"
+	"github.com/practice/multi_cluster_informer/pkg/registry"
+	"github.com/practice/multi_cluster_informer/pkg/tracing"
+	"time"
 )
 
 // TODO: 配置文件
@@ -13,34 +12,105 @@ import (
 var SysConfig *Config
 
 type Config struct {
+	// Include 引入其他配置文件或目录(目录下的 .yaml/.yml 文件)，相对路径相对于当前文件
+	// 被引入的文件可以是配置片段，也可以是只包含 metadata 的单个集群
+	Include []string `json:"include" yaml:"include"`
+	// Defaults 合并到每个集群的默认配置，集群自身的配置优先
+	Defaults       *controller.MetaData `json:"defaults" yaml:"defaults"`
 	MaxReQueueTime int                  `json:"maxRequeueTime" yaml:"maxRequeueTime"`
-	Clusters       []controller.Cluster `json:"clusters" yaml:"clusters"`
+	// CacheSyncTimeout 每个集群等待缓存同步的超时时间，如 30s，为空时一直等待
+	CacheSyncTimeout time.Duration `json:"cacheSyncTimeout" yaml:"cacheSyncTimeout"`
+	// Reload 配置文件热加载，为空时不加载
+	Reload *Reload `json:"reload" yaml:"reload"`
+	// HealthCheck 集群健康检查，为空时不检查
+	HealthCheck *controller.HealthCheck `json:"healthCheck" yaml:"healthCheck"`
+	// Server 内置 HTTP 服务，提供 /healthz /readyz /metrics /debug/clusters，为空时不启动
+	Server *controller.HTTPServer `json:"server" yaml:"server"`
+	// Tracing 通过 OTLP 导出 OpenTelemetry trace，为空时使用 no-op 实现
+	Tracing *tracing.Config `json:"tracing" yaml:"tracing"`
+	// SecretRegistry 从 hub 集群的 Secret 中发现成员集群，为空时不使用
+	SecretRegistry *registry.SecretRegistryConfig `json:"secretRegistry" yaml:"secretRegistry"`
+	// Inventory 从 Cluster API 或 OCM 的集群清单中发现成员集群，为空时不使用
+	Inventory *registry.InventoryConfig `json:"inventory" yaml:"inventory"`
+	// LeaderElection 多副本选主，只有 leader 放入并处理事件，为空时不选主
+	LeaderElection *controller.LeaderElection `json:"leaderElection" yaml:"leaderElection"`
+	// Sharding 多副本分片，每个副本只启动自己负责的集群，为空时不分片，不能与 leaderElection 同时使用
+	Sharding *controller.Sharding `json:"sharding" yaml:"sharding"`
+	// ClusterSets 按集群标签为一组集群统一加入资源列表，热加载时不更新
+	ClusterSets []controller.ClusterSet `json:"clusterSets" yaml:"clusterSets"`
+	// KubeConfigContexts 将一个 kubeconfig 中的多个 context 展开为集群，为空时不使用
+	KubeConfigContexts *KubeConfigContexts  `json:"kubeConfigContexts" yaml:"kubeConfigContexts"`
+	Clusters           []controller.Cluster `json:"clusters" yaml:"clusters"`
+
+	// sources 加载该配置读取的所有文件
+	sources []string
+}
+
+// Reload 配置文件热加载
+type Reload struct {
+	// Interval 检查配置文件是否变化的间隔
+	Interval time.Duration `json:"interval" yaml:"interval"`
+	// EmitDeleteOnRemove 集群从配置中移除时，是否为其缓存中的所有对象放入 delete 事件
+	EmitDeleteOnRemove bool `json:"emitDeleteOnRemove" yaml:"emitDeleteOnRemove"`
 }
 
 func NewConfig() *Config {
 	return &Config{}
 }
 
-func loadConfigFile(path string) []byte {
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		log.Println(err)
-		return nil
+// Options 将配置文件中的选项转换为控制器可选配置
+func (c *Config) Options() []controller.Option {
+	opts := []controller.Option{controller.WithCacheSyncTimeout(c.CacheSyncTimeout)}
+	if c.HealthCheck != nil {
+		opts = append(opts, controller.WithHealthCheck(*c.HealthCheck))
+	}
+	if c.Server != nil {
+		opts = append(opts, controller.WithHTTPServer(*c.Server))
 	}
-	return b
+	if c.LeaderElection != nil {
+		opts = append(opts, controller.WithLeaderElection(*c.LeaderElection))
+	}
+	if c.Sharding != nil {
+		opts = append(opts, controller.WithSharding(*c.Sharding))
+	}
+	if len(c.ClusterSets) > 0 {
+		opts = append(opts, controller.WithClusterSets(c.ClusterSets...))
+	}
+	return opts
 }
 
-func LoadConfig(path string) (*Config, error) {
-	config := NewConfig()
-	if b := loadConfigFile(path); b != nil {
+// Sources 返回加载该配置时读取的所有文件，包括 include 引入的文件
+func (c *Config) Sources() []string {
+	return c.sources
+}
 
-		err := yaml.Unmarshal(b, config)
-		if err != nil {
-			return nil, err
-		}
-		return config, err
-	} else {
-		return nil, fmt.Errorf("load config file error...")
+// LoadConfig 加载 YAML 或 JSON(.json 扩展名)配置文件：合并 include 的文件，展开环境变量，合并 defaults，再校验
+func LoadConfig(path string) (*Config, error) {
+	l := &loader{visited: make(map[string]bool)}
+	config, err := l.load(path, false)
+	if err != nil {
+		return nil, err
+	}
+	config.sources = l.sources
+	if err = config.finalize(); err != nil {
+		return nil, err
 	}
+	return config, nil
+}
 
+// finalize 展开环境变量，合并 defaults，校验后展开 kubeConfigContexts
+func (c *Config) finalize() error {
+	if err := c.expandEnv(); err != nil {
+		return err
+	}
+	c.applyDefaults()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if err := c.expandContexts(); err != nil {
+		return err
+	}
+	// 展开的集群同样需要合并 defaults
+	c.applyDefaults()
+	return nil
 }
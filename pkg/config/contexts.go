@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"k8s.io/client-go/tools/clientcmd"
+	"regexp"
+	"sort"
+)
+
+// KubeConfigContexts 将一个 kubeconfig 中的每个 context 展开为一个集群，context 名即集群名
+type KubeConfigContexts struct {
+	// ConfigPath kubeconfig 文件
+	ConfigPath string `json:"configPath" yaml:"configPath"`
+	// Match 只展开名称匹配该正则的 context，为空时展开全部
+	Match string `json:"match" yaml:"match"`
+	// Insecure 是否跳过证书认证
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// List 每个集群监听的资源
+	List []controller.ResourceAndNamespace `json:"list" yaml:"list"`
+}
+
+// Expand 读取 kubeconfig，为每个匹配的 context 生成集群配置，按 context 名排序
+func (k *KubeConfigContexts) Expand() ([]controller.Cluster, error) {
+	if k.ConfigPath == "" {
+		return nil, fmt.Errorf("kubeConfigContexts: configPath is empty")
+	}
+	var match *regexp.Regexp
+	if k.Match != "" {
+		var err error
+		if match, err = regexp.Compile(k.Match); err != nil {
+			return nil, fmt.Errorf("kubeConfigContexts: invalid match: %v", err)
+		}
+	}
+	raw, err := clientcmd.LoadFromFile(k.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("kubeConfigContexts: %v", err)
+	}
+
+	names := make([]string, 0, len(raw.Contexts))
+	for name := range raw.Contexts {
+		if match == nil || match.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	clusters := make([]controller.Cluster, 0, len(names))
+	for _, name := range names {
+		// 每个集群使用独立的资源列表，避免后续修改互相影响
+		list := make([]controller.ResourceAndNamespace, len(k.List))
+		copy(list, k.List)
+		clusters = append(clusters, controller.Cluster{MetaData: controller.MetaData{
+			ClusterName: name,
+			ConfigPath:  k.ConfigPath,
+			Insecure:    k.Insecure,
+			List:        list,
+			Auth:        controller.Auth{Context: name},
+		}})
+	}
+	return clusters, nil
+}
+
+// expandContexts 将 kubeConfigContexts 展开的集群追加到集群列表
+// clusters 中已显式配置的同名集群优先，不会被覆盖
+func (c *Config) expandContexts() error {
+	if c.KubeConfigContexts == nil {
+		return nil
+	}
+	expanded, err := c.KubeConfigContexts.Expand()
+	if err != nil {
+		return err
+	}
+	explicit := make(map[string]struct{}, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		explicit[cluster.MetaData.ClusterName] = struct{}{}
+	}
+	for _, cluster := range expanded {
+		if _, ok := explicit[cluster.MetaData.ClusterName]; ok {
+			continue
+		}
+		c.Clusters = append(c.Clusters, cluster)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: c
+  cluster:
+    server: https://c.example.com
+users:
+- name: u
+  user:
+    token: t
+contexts:
+- name: dev-b
+  context: {cluster: c, user: u}
+- name: dev-a
+  context: {cluster: c, user: u}
+- name: prod
+  context: {cluster: c, user: u}
+`
+
+func TestExpandContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := ioutil.WriteFile(path, []byte(testKubeConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		KubeConfigContexts: &KubeConfigContexts{
+			ConfigPath: path,
+			Match:      "^dev-",
+			List:       []controller.ResourceAndNamespace{{RType: "pods", Namespace: "all"}},
+		},
+		Clusters: []controller.Cluster{{MetaData: controller.MetaData{ClusterName: "dev-b", ConfigPath: "/other"}}},
+	}
+	if err := c.expandContexts(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(c.Clusters))
+	}
+	if c.Clusters[0].MetaData.ConfigPath != "/other" {
+		t.Fatal("explicit cluster should not be overridden")
+	}
+	added := c.Clusters[1].MetaData
+	if added.ClusterName != "dev-a" || added.Context != "dev-a" || len(added.List) != 1 {
+		t.Fatalf("unexpected expanded cluster: %+v", added)
+	}
+	restConfig, err := c.Clusters[1].RESTConfig()
+	if err != nil || restConfig.Host != "https://c.example.com" {
+		t.Fatalf("unexpected rest config: %v %v", restConfig, err)
+	}
+}
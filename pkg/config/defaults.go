@@ -0,0 +1,80 @@
+package config
+
+import (
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+)
+
+// applyDefaults 将 defaults 合并到每个集群，集群自身的配置优先，可重复调用
+func (c *Config) applyDefaults() {
+	if c.Defaults == nil {
+		return
+	}
+	for i := range c.Clusters {
+		mergeMetaData(&c.Clusters[i].MetaData, *c.Defaults)
+	}
+}
+
+// mergeMetaData 将默认配置 d 合并到集群配置 m
+// 集群没有配置连接方式时才使用默认的连接方式与凭证，如默认共享 kubeconfig、集群只指定 context
+// insecure 只能由默认值开启；labels 与 list 合并，相同的 key 或资源以集群自身为准
+func mergeMetaData(m *controller.MetaData, d controller.MetaData) {
+	if !m.InCluster && m.ConfigPath == "" && m.KubeConfig == "" && m.Server == "" {
+		m.InCluster = d.InCluster
+		m.ConfigPath = d.ConfigPath
+		m.KubeConfig = d.KubeConfig
+		m.Server = d.Server
+		setDefault(&m.Context, d.Context)
+		setDefault(&m.Token, d.Token)
+		setDefault(&m.TokenFile, d.TokenFile)
+		setDefault(&m.CAFile, d.CAFile)
+		setDefault(&m.CAData, d.CAData)
+		setDefault(&m.CertFile, d.CertFile)
+		setDefault(&m.KeyFile, d.KeyFile)
+		if m.Exec == nil {
+			m.Exec = d.Exec
+		}
+	}
+	m.Insecure = m.Insecure || d.Insecure
+	if m.QPS == 0 {
+		m.QPS = d.QPS
+	}
+	if m.Burst == 0 {
+		m.Burst = d.Burst
+	}
+	if m.Timeout == 0 {
+		m.Timeout = d.Timeout
+	}
+	setDefault(&m.ProxyURL, d.ProxyURL)
+
+	if len(d.Labels) > 0 {
+		merged := make(map[string]string, len(d.Labels)+len(m.Labels))
+		for k, v := range d.Labels {
+			merged[k] = v
+		}
+		for k, v := range m.Labels {
+			merged[k] = v
+		}
+		m.Labels = merged
+	}
+
+	if len(d.List) > 0 {
+		list := make([]controller.ResourceAndNamespace, 0, len(m.List)+len(d.List))
+		seen := make(map[string]struct{}, len(m.List))
+		for _, r := range m.List {
+			seen[r.RType+"/"+r.Namespace] = struct{}{}
+			list = append(list, r)
+		}
+		for _, r := range d.List {
+			if _, ok := seen[r.RType+"/"+r.Namespace]; !ok {
+				list = append(list, r)
+			}
+		}
+		m.List = list
+	}
+}
+
+func setDefault(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envPattern 匹配 ${VAR} 与 ${VAR:-default}，不处理 $VAR，避免误伤正则中的 $
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv 展开字符串中的环境变量，变量未设置且没有默认值时返回错误
+func expandEnv(s string) (string, error) {
+	var missing []string
+	res := envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := envPattern.FindStringSubmatch(match)
+		if v, ok := os.LookupEnv(groups[1]); ok {
+			return v
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		missing = append(missing, groups[1])
+		return match
+	})
+	if len(missing) > 0 {
+		return s, fmt.Errorf("environment variable %s not set", strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+// expandEnv 展开路径、凭证等字符串字段中的环境变量
+func (c *Config) expandEnv() error {
+	var errs errorList
+	if c.Defaults != nil {
+		expandMetaData(&errs, "defaults", c.Defaults)
+	}
+	if c.SecretRegistry != nil {
+		expandMetaData(&errs, "secretRegistry.hub", &c.SecretRegistry.Hub)
+	}
+	if c.Inventory != nil {
+		expandMetaData(&errs, "inventory.hub", &c.Inventory.Hub)
+	}
+	if c.KubeConfigContexts != nil {
+		expandField(&errs, "kubeConfigContexts.configPath", &c.KubeConfigContexts.ConfigPath)
+	}
+	for i := range c.Clusters {
+		expandMetaData(&errs, fmt.Sprintf("clusters[%d].metadata", i), &c.Clusters[i].MetaData)
+	}
+	return errs.err()
+}
+
+// expandMetaData 展开集群连接相关的字段
+func expandMetaData(errs *errorList, path string, m *controller.MetaData) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"configPath", &m.ConfigPath}, {"kubeConfig", &m.KubeConfig}, {"context", &m.Context},
+		{"server", &m.Server}, {"token", &m.Token}, {"tokenFile", &m.TokenFile},
+		{"caFile", &m.CAFile}, {"caData", &m.CAData}, {"certFile", &m.CertFile},
+		{"keyFile", &m.KeyFile}, {"proxyURL", &m.ProxyURL},
+	}
+	for _, f := range fields {
+		expandField(errs, path+"."+f.name, f.value)
+	}
+	if m.Exec != nil {
+		// exec 可能与其他集群共享，复制后再修改
+		exec := *m.Exec
+		exec.Args = append([]string(nil), exec.Args...)
+		expandField(errs, path+".exec.command", &exec.Command)
+		for i := range exec.Args {
+			expandField(errs, fmt.Sprintf("%s.exec.args[%d]", path, i), &exec.Args[i])
+		}
+		if len(exec.Env) > 0 {
+			env := make(map[string]string, len(exec.Env))
+			for k, v := range exec.Env {
+				expandField(errs, path+".exec.env."+k, &v)
+				env[k] = v
+			}
+			exec.Env = env
+		}
+		m.Exec = &exec
+	}
+}
+
+func expandField(errs *errorList, path string, field *string) {
+	v, err := expandEnv(*field)
+	if err != nil {
+		errs.add(path, "%v", err)
+		return
+	}
+	*field = v
+}
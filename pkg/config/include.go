@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	k8syaml "sigs.k8s.io/yaml"
+	"strings"
+)
+
+// includeExts include 目录时加载的文件类型
+var includeExts = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// loader 加载配置文件及其 include 的文件
+type loader struct {
+	// visited 已加载的文件，同一文件只能被加载一次，避免循环引入
+	visited map[string]bool
+	// sources 按加载顺序记录的所有文件
+	sources []string
+}
+
+// load 加载单个文件，并按顺序合并其 include 的文件，当前文件中的配置优先
+func (l *loader) load(path string, included bool) (*Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if l.visited[abs] {
+		return nil, fmt.Errorf("%s: included more than once or include cycle", path)
+	}
+	l.visited[abs] = true
+	l.sources = append(l.sources, abs)
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON 文件可能使用 tab 缩进，先转换为 YAML
+	if isJSONFile(path) {
+		if raw, err = k8syaml.JSONToYAML(raw); err != nil {
+			return nil, inFile(path, err)
+		}
+	}
+
+	// 被引入的文件只包含 metadata 时视为单个集群
+	if included && isClusterFile(raw) {
+		if err = validateClusterSchema(raw); err != nil {
+			return nil, inFile(path, err)
+		}
+		var cluster controller.Cluster
+		if err = yaml.Unmarshal(raw, &cluster); err != nil {
+			return nil, inFile(path, err)
+		}
+		return &Config{Clusters: []controller.Cluster{cluster}}, nil
+	}
+
+	config, err := parseConfig(raw, false)
+	if err != nil {
+		return nil, inFile(path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, include := range config.Include {
+		include, err = expandEnv(include)
+		if err != nil {
+			return nil, inFile(path, fmt.Errorf("include[%d]: %v", i, err))
+		}
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+		files, err := includeFiles(include)
+		if err != nil {
+			return nil, inFile(path, fmt.Errorf("include[%d]: %v", i, err))
+		}
+		for _, file := range files {
+			sub, err := l.load(file, true)
+			if err != nil {
+				return nil, err
+			}
+			config.merge(sub)
+		}
+	}
+	return config, nil
+}
+
+// includeFiles include 为目录时返回目录下的配置文件，按文件名排序
+func includeFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !includeExts[filepath.Ext(entry.Name())] {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	return files, nil
+}
+
+// isJSONFile 按扩展名判断是否为 JSON 文件
+func isJSONFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// parseConfig 按 Schema 校验并解析配置内容，json 为 true 时 raw 为 JSON 格式
+func parseConfig(raw []byte, json bool) (*Config, error) {
+	if json {
+		var err error
+		if raw, err = k8syaml.JSONToYAML(raw); err != nil {
+			return nil, err
+		}
+	}
+	// 先按 Schema 校验，拼错的字段名与类型错误会带上 YAML 路径
+	if err := ValidateSchema(raw); err != nil {
+		return nil, err
+	}
+	config := NewConfig()
+	if err := yaml.Unmarshal(raw, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// isClusterFile 文件顶层是否为单个集群的 metadata
+func isClusterFile(raw []byte) bool {
+	var top map[string]interface{}
+	if err := yaml.Unmarshal(raw, &top); err != nil {
+		return false
+	}
+	_, ok := top["metadata"]
+	return ok
+}
+
+// inFile 为错误加上文件名
+func inFile(path string, err error) error {
+	if verr, ok := err.(*ValidationError); ok {
+		for i := range verr.Errors {
+			verr.Errors[i].File = path
+		}
+		return verr
+	}
+	return fmt.Errorf("%s: %v", path, err)
+}
+
+// merge 合并被引入的配置：列表追加，其余字段只在当前配置未设置时使用被引入的值
+func (c *Config) merge(o *Config) {
+	if c.Defaults == nil {
+		c.Defaults = o.Defaults
+	}
+	if c.MaxReQueueTime == 0 {
+		c.MaxReQueueTime = o.MaxReQueueTime
+	}
+	if c.CacheSyncTimeout == 0 {
+		c.CacheSyncTimeout = o.CacheSyncTimeout
+	}
+	if c.Reload == nil {
+		c.Reload = o.Reload
+	}
+	if c.HealthCheck == nil {
+		c.HealthCheck = o.HealthCheck
+	}
+	if c.Server == nil {
+		c.Server = o.Server
+	}
+	if c.Tracing == nil {
+		c.Tracing = o.Tracing
+	}
+	if c.SecretRegistry == nil {
+		c.SecretRegistry = o.SecretRegistry
+	}
+	if c.Inventory == nil {
+		c.Inventory = o.Inventory
+	}
+	if c.LeaderElection == nil {
+		c.LeaderElection = o.LeaderElection
+	}
+	if c.Sharding == nil {
+		c.Sharding = o.Sharding
+	}
+	if c.KubeConfigContexts == nil {
+		c.KubeConfigContexts = o.KubeConfigContexts
+	}
+	c.ClusterSets = append(c.ClusterSets, o.ClusterSets...)
+	c.Clusters = append(c.Clusters, o.Clusters...)
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigIncludeDefaultsEnv(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("TEST_KUBECONFIG_DIR", "/etc/kube")
+	defer os.Unsetenv("TEST_KUBECONFIG_DIR")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), `
+include:
+  - common.yaml
+  - clusters.d
+defaults:
+  configPath: ${TEST_KUBECONFIG_DIR}/shared
+  qps: 20
+  labels:
+    env: dev
+  list:
+    - rType: pods
+      namespace: all
+clusters:
+  - metadata:
+      clusterName: main
+      configPath: ${TEST_KUBECONFIG_DIR}/main
+      labels:
+        env: prod
+`)
+	writeFile(t, filepath.Join(dir, "common.yaml"), `
+maxRequeueTime: 3
+cacheSyncTimeout: 30s
+`)
+	writeFile(t, filepath.Join(dir, "clusters.d", "b.yaml"), `
+metadata:
+  clusterName: b
+  context: ctx-b
+`)
+	writeFile(t, filepath.Join(dir, "clusters.d", "a.yml"), `
+metadata:
+  clusterName: a
+  token: ${TEST_MISSING_TOKEN:-fallback}
+  server: https://a.example.com
+  list:
+    - rType: pods
+      namespace: default
+`)
+	writeFile(t, filepath.Join(dir, "clusters.d", "README.md"), "ignored")
+
+	c, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxReQueueTime != 3 || c.CacheSyncTimeout.Seconds() != 30 {
+		t.Fatalf("common.yaml not merged: %+v", c)
+	}
+	if len(c.Sources()) != 4 {
+		t.Fatalf("expected 4 sources, got %v", c.Sources())
+	}
+	if len(c.Clusters) != 3 {
+		t.Fatalf("expected 3 clusters, got %d", len(c.Clusters))
+	}
+
+	main, a, b := c.Clusters[0].MetaData, c.Clusters[1].MetaData, c.Clusters[2].MetaData
+	if main.ConfigPath != "/etc/kube/main" || main.Labels["env"] != "prod" || main.QPS != 20 || len(main.List) != 1 {
+		t.Fatalf("unexpected main cluster: %+v", main)
+	}
+	if a.ClusterName != "a" || a.ConfigPath != "" || a.Token != "fallback" || len(a.List) != 2 {
+		t.Fatalf("unexpected cluster a: %+v", a)
+	}
+	if b.ConfigPath != "/etc/kube/shared" || b.Context != "ctx-b" || b.Labels["env"] != "dev" {
+		t.Fatalf("unexpected cluster b: %+v", b)
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yaml"), "include: [cluster.yaml]\n")
+	writeFile(t, filepath.Join(dir, "cluster.yaml"), "metadata:\n  clusterName: a\n  configPath: ${TEST_MISSING_PATH}\n  list:\n    - rType: pod\n      namespace: all\n")
+
+	_, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Path != "metadata.list[0].rType" || verr.Errors[0].File != filepath.Join(dir, "cluster.yaml") {
+		t.Fatalf("expected schema error in included file, got %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "cluster.yaml"), "metadata:\n  clusterName: a\n  configPath: ${TEST_MISSING_PATH}\n")
+	_, err = LoadConfig(filepath.Join(dir, "config.yaml"))
+	if !errors.As(err, &verr) || verr.Errors[0].Path != "clusters[0].metadata.configPath" {
+		t.Fatalf("expected missing env error, got %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "cluster.yaml"), "include: [config.yaml]\n")
+	if _, err = LoadConfig(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("expected include cycle error")
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// ConfigKind 保存在集群中的配置对象类型，spec 与配置文件格式相同
+const ConfigKind = "MultiClusterInformerConfig"
+
+// ConfigResource MultiClusterInformerConfig 对应的资源，CRD 见 deploy/crd.yaml
+var ConfigResource = schema.GroupVersionResource{
+	Group:    "multicluster.practice.io",
+	Version:  "v1alpha1",
+	Resource: "multiclusterinformerconfigs",
+}
+
+// LoadConfigFromCluster 从 hub 集群读取 MultiClusterInformerConfig 对象并转换为配置，便于通过 GitOps 管理
+func LoadConfigFromCluster(ctx context.Context, client dynamic.Interface, namespace, name string) (*Config, error) {
+	u, err := client.Resource(ConfigResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return LoadConfigFromObject(u)
+}
+
+// LoadConfigFromObject 将 MultiClusterInformerConfig 对象的 spec 转换为配置，校验与配置文件相同
+// 对象中不支持 include，因为没有可以引用的文件
+func LoadConfigFromObject(u *unstructured.Unstructured) (*Config, error) {
+	source := fmt.Sprintf("%s %s/%s", ConfigKind, u.GetNamespace(), u.GetName())
+	if kind := u.GetKind(); kind != "" && kind != ConfigKind {
+		return nil, fmt.Errorf("%s: unexpected kind %q", source, kind)
+	}
+	spec, ok := u.Object["spec"]
+	if !ok {
+		return nil, fmt.Errorf("%s: spec is empty", source)
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+	config, err := parseConfig(raw, true)
+	if err != nil {
+		return nil, inFile(source, err)
+	}
+	if len(config.Include) > 0 {
+		return nil, inFile(source, &ValidationError{Errors: []FieldError{{Path: "include", Message: "not supported in " + ConfigKind}}})
+	}
+	if err = config.finalize(); err != nil {
+		return nil, inFile(source, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFromCluster(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "multicluster.practice.io/v1alpha1",
+		"kind":       ConfigKind,
+		"metadata":   map[string]interface{}{"name": "default", "namespace": "mci"},
+		"spec": map[string]interface{}{
+			"maxRequeueTime":   int64(4),
+			"cacheSyncTimeout": "30s",
+			"clusters": []interface{}{
+				map[string]interface{}{"metadata": map[string]interface{}{
+					"clusterName": "cluster1",
+					"server":      "https://c.example.com",
+					"list":        []interface{}{map[string]interface{}{"rType": "pods", "namespace": "all"}},
+				}},
+			},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ConfigResource: ConfigKind + "List"}, obj)
+
+	c, err := LoadConfigFromCluster(context.Background(), client, "mci", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxReQueueTime != 4 || c.CacheSyncTimeout.Seconds() != 30 || len(c.Clusters) != 1 || c.Clusters[0].MetaData.Server != "https://c.example.com" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	spec := obj.Object["spec"].(map[string]interface{})
+	spec["include"] = []interface{}{"other.yaml"}
+	spec["maxRequeueTime"] = "4"
+	if _, err = LoadConfigFromObject(obj); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := "{\n\t\"maxRequeueTime\": 2,\n\t\"clusters\": [{\"metadata\": {\"clusterName\": \"a\", \"inCluster\": true}}]\n}\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxReQueueTime != 2 || !c.Clusters[0].MetaData.InCluster {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+}
@@ -0,0 +1,326 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/practice/multi_cluster_informer/pkg/registry"
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net/url"
+	"regexp"
+	k8syaml "sigs.k8s.io/yaml"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema 配置文件的 JSON Schema，可用于编辑器补全与 CI 校验
+//
+//go:embed schema.json
+var Schema []byte
+
+// 支持监听的资源类型
+var supportedResources = map[string]struct{}{
+	queue.Pods: {}, queue.Services: {}, queue.ConfigMaps: {}, queue.Secrets: {}, queue.Events: {},
+	queue.Deployments: {}, queue.Statefulsets: {}, queue.Daemonsets: {},
+}
+
+// FieldError 单个配置错误，Path 为出错字段的 YAML 路径，如 clusters[1].metadata.list[0].rType
+type FieldError struct {
+	// File 出错的文件，为空时表示合并后的配置
+	File    string
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.File != "" {
+		msg = e.File + ": " + msg
+	}
+	return msg
+}
+
+// ValidationError 配置校验失败，包含所有错误而不是只有第一个
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, "  "+fe.Error())
+	}
+	return fmt.Sprintf("invalid config, %d error(s):\n%s", len(e.Errors), strings.Join(msgs, "\n"))
+}
+
+// errorList 收集校验错误
+type errorList []FieldError
+
+func (l *errorList) add(path string, format string, args ...interface{}) {
+	*l = append(*l, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// err 没有错误时返回 nil，避免返回包含空指针的 error 接口
+func (l errorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: l}
+}
+
+// ValidateSchema 使用 JSON Schema 校验原始配置文件内容，可以发现拼错的字段名与类型错误
+func ValidateSchema(raw []byte) error {
+	doc, err := k8syaml.YAMLToJSON(raw)
+	if err != nil {
+		return err
+	}
+	return validateSchemaJSON(doc)
+}
+
+// validateClusterSchema 校验只包含单个集群的文件，错误路径相对于该集群
+func validateClusterSchema(raw []byte) error {
+	doc, err := k8syaml.YAMLToJSON(raw)
+	if err != nil {
+		return err
+	}
+	wrapped := append(append([]byte(`{"clusters":[`), doc...), []byte(`]}`)...)
+	err = validateSchemaJSON(wrapped)
+	if verr, ok := err.(*ValidationError); ok {
+		for i := range verr.Errors {
+			verr.Errors[i].Path = strings.TrimPrefix(strings.TrimPrefix(verr.Errors[i].Path, "clusters[0]"), ".")
+		}
+	}
+	return err
+}
+
+// validateSchemaJSON 使用 JSON Schema 校验 JSON 格式的配置
+func validateSchemaJSON(doc []byte) error {
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(Schema), gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return err
+	}
+	var errs errorList
+	for _, re := range result.Errors() {
+		// allOf 的子错误已单独报告
+		if re.Type() == "number_all_of" {
+			continue
+		}
+		path := yamlPath(re.Field())
+		// 多余字段与缺少字段的错误定位到字段本身
+		if re.Type() == "additional_property_not_allowed" || re.Type() == "required" {
+			if property, ok := re.Details()["property"].(string); ok {
+				path = joinPath(path, property)
+			}
+		}
+		// 部分描述以 JSON 风格的字段路径开头，路径已单独给出
+		errs.add(path, "%s", strings.TrimPrefix(re.Description(), re.Field()+" "))
+	}
+	return errs.err()
+}
+
+// yamlPath 将 gojsonschema 的字段路径 clusters.0.metadata 转换为 clusters[0].metadata
+func yamlPath(field string) string {
+	if field == "(root)" {
+		return ""
+	}
+	var path string
+	for _, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			path += "[" + part + "]"
+			continue
+		}
+		path = joinPath(path, part)
+	}
+	return path
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// Validate 校验配置的取值，返回包含所有错误的 *ValidationError
+// 与 ValidateSchema 不同，这里检查 Schema 无法表达的约束，如集群名重复、正则与标签选择器是否合法
+func (c *Config) Validate() error {
+	var errs errorList
+	if c.MaxReQueueTime < 0 {
+		errs.add("maxRequeueTime", "must be >= 0, got %d", c.MaxReQueueTime)
+	}
+	if c.CacheSyncTimeout < 0 {
+		errs.add("cacheSyncTimeout", "must be >= 0, got %v", c.CacheSyncTimeout)
+	}
+	if c.Reload != nil && c.Reload.Interval <= 0 {
+		errs.add("reload.interval", "must be > 0, got %v", c.Reload.Interval)
+	}
+	if hc := c.HealthCheck; hc != nil {
+		if hc.Interval < 0 {
+			errs.add("healthCheck.interval", "must be >= 0, got %v", hc.Interval)
+		}
+		if hc.Timeout < 0 {
+			errs.add("healthCheck.timeout", "must be >= 0, got %v", hc.Timeout)
+		}
+		if hc.FailureThreshold < 0 {
+			errs.add("healthCheck.failureThreshold", "must be >= 0, got %d", hc.FailureThreshold)
+		}
+	}
+	if s := c.Server; s != nil {
+		if s.Addr == "" {
+			errs.add("server.addr", "must not be empty")
+		}
+		if s.ShutdownTimeout < 0 {
+			errs.add("server.shutdownTimeout", "must be >= 0, got %v", s.ShutdownTimeout)
+		}
+	}
+	if t := c.Tracing; t != nil && t.SampleRatio != nil && (*t.SampleRatio < 0 || *t.SampleRatio > 1) {
+		errs.add("tracing.sampleRatio", "must be between 0 and 1, got %v", *t.SampleRatio)
+	}
+	if le := c.LeaderElection; le != nil {
+		if le.HomeCluster == "" {
+			errs.add("leaderElection.homeCluster", "must not be empty")
+		}
+		// 与 client-go 的要求一致，未设置的字段使用默认值后再比较
+		d := le.WithDefaults()
+		if d.LeaseDuration <= d.RenewDeadline {
+			errs.add("leaderElection.leaseDuration", "must be greater than renewDeadline (%v)", d.RenewDeadline)
+		}
+		if d.RenewDeadline <= d.RetryPeriod {
+			errs.add("leaderElection.renewDeadline", "must be greater than retryPeriod (%v)", d.RetryPeriod)
+		}
+	}
+	if s := c.Sharding; s != nil {
+		if s.HomeCluster == "" {
+			errs.add("sharding.homeCluster", "must not be empty")
+		}
+		// 分片时每个集群只有一个副本运行，选主会让非 leader 负责的集群没有事件
+		if c.LeaderElection != nil {
+			errs.add("sharding", "must not be used together with leaderElection")
+		}
+		d := s.WithDefaults()
+		if d.LeaseDuration <= d.RenewInterval {
+			errs.add("sharding.leaseDuration", "must be greater than renewInterval (%v)", d.RenewInterval)
+		}
+		if s.VirtualNodes < 0 {
+			errs.add("sharding.virtualNodes", "must be >= 0, got %d", s.VirtualNodes)
+		}
+	}
+	if s := c.SecretRegistry; s != nil {
+		validateConnection(&errs, "secretRegistry.hub", s.Hub)
+		validateSelector(&errs, "secretRegistry.labelSelector", s.LabelSelector)
+		validateList(&errs, "secretRegistry.list", s.List)
+	}
+	if inv := c.Inventory; inv != nil {
+		if inv.Provider != registry.ProviderClusterAPI && inv.Provider != registry.ProviderOCM {
+			errs.add("inventory.provider", "must be %q or %q, got %q", registry.ProviderClusterAPI, registry.ProviderOCM, inv.Provider)
+		}
+		if inv.Provider == registry.ProviderOCM && (inv.SecretNamespace == "" || inv.SecretName == "") {
+			errs.add("inventory.secretName", "secretNamespace and secretName are required for %q, ManagedCluster has no kubeconfig readable from the hub", registry.ProviderOCM)
+		}
+		if inv.ResyncPeriod < 0 {
+			errs.add("inventory.resyncPeriod", "must be >= 0, got %v", inv.ResyncPeriod)
+		}
+		validateConnection(&errs, "inventory.hub", inv.Hub)
+		validateSelector(&errs, "inventory.labelSelector", inv.LabelSelector)
+		validateList(&errs, "inventory.list", inv.List)
+	}
+	for i, set := range c.ClusterSets {
+		path := fmt.Sprintf("clusterSets[%d]", i)
+		validateSelector(&errs, path+".selector", set.Selector)
+		validateList(&errs, path+".list", set.List)
+	}
+	if k := c.KubeConfigContexts; k != nil {
+		if k.ConfigPath == "" {
+			errs.add("kubeConfigContexts.configPath", "must not be empty")
+		}
+		if _, err := regexp.Compile(k.Match); err != nil {
+			errs.add("kubeConfigContexts.match", "invalid regexp: %v", err)
+		}
+		validateList(&errs, "kubeConfigContexts.list", k.List)
+	}
+
+	names := make(map[string]int, len(c.Clusters))
+	for i, cluster := range c.Clusters {
+		path := fmt.Sprintf("clusters[%d].metadata", i)
+		m := cluster.MetaData
+		switch first, dup := names[m.ClusterName]; {
+		case m.ClusterName == "":
+			errs.add(path+".clusterName", "must not be empty")
+		case dup:
+			errs.add(path+".clusterName", "duplicate cluster name %q, already used by clusters[%d]", m.ClusterName, first)
+		default:
+			names[m.ClusterName] = i
+		}
+		keys := make([]string, 0, len(m.Labels))
+		for k := range m.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := m.Labels[k]
+			for _, msg := range validation.IsQualifiedName(k) {
+				errs.add(path+".labels", "invalid key %q: %s", k, msg)
+			}
+			for _, msg := range validation.IsValidLabelValue(v) {
+				errs.add(path+".labels."+k, "invalid value %q: %s", v, msg)
+			}
+		}
+		validateConnection(&errs, path, m)
+		validateList(&errs, path+".list", m.List)
+	}
+	return errs.err()
+}
+
+// validateConnection 校验集群连接方式
+func validateConnection(errs *errorList, path string, m controller.MetaData) {
+	if !m.InCluster && m.ConfigPath == "" && m.KubeConfig == "" && m.Server == "" {
+		errs.add(path, "one of inCluster, configPath, kubeConfig or server is required")
+	}
+	if (m.CertFile == "") != (m.KeyFile == "") {
+		errs.add(path, "certFile and keyFile must be set together")
+	}
+	if m.Exec != nil && m.Exec.Command == "" {
+		errs.add(path+".exec.command", "must not be empty")
+	}
+	if m.QPS < 0 {
+		errs.add(path+".qps", "must be >= 0, got %v", m.QPS)
+	}
+	if m.Burst < 0 {
+		errs.add(path+".burst", "must be >= 0, got %d", m.Burst)
+	}
+	if m.Timeout < 0 {
+		errs.add(path+".timeout", "must be >= 0, got %v", m.Timeout)
+	}
+	if m.ProxyURL != "" {
+		if _, err := url.Parse(m.ProxyURL); err != nil {
+			errs.add(path+".proxyURL", "invalid url: %v", err)
+		}
+	}
+}
+
+// validateSelector 校验标签选择器
+func validateSelector(errs *errorList, path string, selector string) {
+	if _, err := labels.Parse(selector); err != nil {
+		errs.add(path, "invalid label selector: %v", err)
+	}
+}
+
+// validateList 校验资源列表
+func validateList(errs *errorList, path string, list []controller.ResourceAndNamespace) {
+	for i, r := range list {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if _, ok := supportedResources[r.RType]; !ok {
+			errs.add(itemPath+".rType", "unsupported resource type %q", r.RType)
+		}
+		if r.Namespace == "" {
+			errs.add(itemPath+".namespace", "must not be empty, use %q for all namespaces", queue.All)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"github.com/go-yaml/yaml"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSchemaExample(t *testing.T) {
+	raw, err := ioutil.ReadFile("../../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateSchema(raw); err != nil {
+		t.Fatalf("example config should be valid: %v", err)
+	}
+}
+
+func TestValidateSchemaPaths(t *testing.T) {
+	raw := []byte(`
+maxrequeuetime: 5
+cacheSyncTimeout: 1 minute
+clusters:
+  - metadata:
+      clusterName: cluster1
+      configPath: /tmp/config
+      list:
+        - rType: pod
+          namespace: all
+  - metadata:
+      configPath: /tmp/config
+`)
+	err := ValidateSchema(raw)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	paths := make(map[string]bool)
+	for _, fe := range verr.Errors {
+		paths[fe.Path] = true
+	}
+	for _, want := range []string{"maxrequeuetime", "cacheSyncTimeout", "clusters[0].metadata.list[0].rType", "clusters[1].metadata.clusterName"} {
+		if !paths[want] {
+			t.Errorf("missing error for %s, got %v", want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := &Config{}
+	raw := []byte(`
+maxRequeueTime: -1
+leaderElection:
+  homeCluster: cluster1
+sharding:
+  homeCluster: cluster1
+  leaseDuration: 5s
+clusterSets:
+  - selector: "env in (prod"
+clusters:
+  - metadata:
+      clusterName: cluster1
+      list:
+        - rType: foo
+  - metadata:
+      clusterName: cluster1
+      configPath: /tmp/config
+`)
+	if err := yaml.Unmarshal(raw, c); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	var paths []string
+	for _, fe := range verr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	want := []string{
+		"maxRequeueTime",
+		"sharding",
+		"sharding.leaseDuration",
+		"clusterSets[0].selector",
+		"clusters[0].metadata",
+		"clusters[0].metadata.list[0].rType",
+		"clusters[0].metadata.list[0].namespace",
+		"clusters[1].metadata.clusterName",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got paths %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// defaultExecAPIVersion exec 插件未指定 apiVersion 时使用的版本
+const defaultExecAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// Auth 集群的认证方式与客户端参数
+// 认证来源优先级：inCluster > configPath > kubeConfig > server，
+// token、证书、exec 等字段在任意来源之上生效，用于覆盖 kubeconfig 中的同名配置
+type Auth struct {
+	// InCluster 使用 Pod 内的 ServiceAccount 连接所在集群
+	InCluster bool `json:"inCluster" yaml:"inCluster"`
+	// Context 使用 kubeconfig 中的指定 context，为空时使用 current-context
+	Context string `json:"context" yaml:"context"`
+	// Server apiserver 地址，不使用 kubeconfig 时必填
+	Server string `json:"server" yaml:"server"`
+	// Token bearer token
+	Token string `json:"token" yaml:"token"`
+	// TokenFile bearer token 文件，会定期重新读取
+	TokenFile string `json:"tokenFile" yaml:"tokenFile"`
+	// CAFile CA 证书文件
+	CAFile string `json:"caFile" yaml:"caFile"`
+	// CAData CA 证书内容(PEM)
+	CAData string `json:"caData" yaml:"caData"`
+	// CertFile 客户端证书文件
+	CertFile string `json:"certFile" yaml:"certFile"`
+	// KeyFile 客户端私钥文件
+	KeyFile string `json:"keyFile" yaml:"keyFile"`
+	// Exec exec 凭证插件，如 aws eks get-token、gke-gcloud-auth-plugin
+	Exec *ExecConfig `json:"exec" yaml:"exec"`
+
+	// QPS 客户端限流，0 表示使用 client-go 默认值
+	QPS float32 `json:"qps" yaml:"qps"`
+	// Burst 客户端突发请求数，0 表示使用 client-go 默认值
+	Burst int `json:"burst" yaml:"burst"`
+	// Timeout 单个请求超时时间，0 表示不限制
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// ProxyURL 访问 apiserver 使用的代理，如 http://proxy:3128、socks5://proxy:1080
+	ProxyURL string `json:"proxyURL" yaml:"proxyURL"`
+}
+
+// ExecConfig exec 凭证插件配置
+type ExecConfig struct {
+	Command    string            `json:"command" yaml:"command"`
+	Args       []string          `json:"args" yaml:"args"`
+	Env        map[string]string `json:"env" yaml:"env"`
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"` // 默认 client.authentication.k8s.io/v1beta1
+}
+
+// RESTConfig 根据集群信息生成 rest.Config，也可用于创建 dynamic 等其他客户端
+func (c *Cluster) RESTConfig() (*rest.Config, error) {
+	config, err := c.baseRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.MetaData.Auth.apply(config); err != nil {
+		return nil, err
+	}
+	if c.MetaData.Insecure {
+		// 跳过证书认证时不能同时指定 CA，否则 client-go 会报错
+		config.Insecure = true
+		config.CAFile = ""
+		config.CAData = nil
+	}
+	return config, nil
+}
+
+// baseRESTConfig 按优先级选择认证来源
+func (c *Cluster) baseRESTConfig() (*rest.Config, error) {
+	m := c.MetaData
+	switch {
+	case m.InCluster:
+		return rest.InClusterConfig()
+	case m.ConfigPath != "":
+		rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: m.ConfigPath}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: m.Context}
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	case m.KubeConfig != "":
+		raw, err := clientcmd.Load([]byte(m.KubeConfig))
+		if err != nil {
+			return nil, err
+		}
+		return clientcmd.NewNonInteractiveClientConfig(*raw, m.Context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	case m.Server != "":
+		return &rest.Config{Host: m.Server}, nil
+	default:
+		return nil, errors.New("无法找到集群client端")
+	}
+}
+
+// apply 将认证覆盖项与客户端参数写入 rest.Config
+func (a *Auth) apply(config *rest.Config) error {
+	if a.Server != "" {
+		config.Host = a.Server
+	}
+	if a.Token != "" || a.TokenFile != "" {
+		config.BearerToken = a.Token
+		config.BearerTokenFile = a.TokenFile
+	}
+	if a.CAFile != "" || a.CAData != "" {
+		config.CAFile = a.CAFile
+		config.CAData = []byte(a.CAData)
+	}
+	if a.CertFile != "" || a.KeyFile != "" {
+		if a.CertFile == "" || a.KeyFile == "" {
+			return errors.New("certFile 与 keyFile 需要同时指定")
+		}
+		config.CertFile = a.CertFile
+		config.KeyFile = a.KeyFile
+		config.CertData = nil
+		config.KeyData = nil
+	}
+	if a.Exec != nil {
+		if a.Exec.Command == "" {
+			return errors.New("exec 插件未指定 command")
+		}
+		config.ExecProvider = a.Exec.provider()
+		config.AuthProvider = nil
+	}
+	if a.QPS > 0 {
+		config.QPS = a.QPS
+	}
+	if a.Burst > 0 {
+		config.Burst = a.Burst
+	}
+	if a.Timeout > 0 {
+		config.Timeout = a.Timeout
+	}
+	if a.ProxyURL != "" {
+		proxy, err := url.Parse(a.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("proxyURL 解析失败: %v", err)
+		}
+		config.Proxy = http.ProxyURL(proxy)
+	}
+	return nil
+}
+
+// provider 转换为 client-go 的 exec 配置
+func (e *ExecConfig) provider() *clientcmdapi.ExecConfig {
+	apiVersion := e.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultExecAPIVersion
+	}
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := make([]clientcmdapi.ExecEnvVar, 0, len(names))
+	for _, name := range names {
+		env = append(env, clientcmdapi.ExecEnvVar{Name: name, Value: e.Env[name]})
+	}
+	return &clientcmdapi.ExecConfig{
+		Command:         e.Command,
+		Args:            e.Args,
+		Env:             env,
+		APIVersion:      apiVersion,
+		InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+current-context: a
+clusters:
+- name: a
+  cluster:
+    server: https://a.example.com
+- name: b
+  cluster:
+    server: https://b.example.com
+users:
+- name: u
+  user:
+    token: kubeconfig-token
+contexts:
+- name: a
+  context:
+    cluster: a
+    user: u
+- name: b
+  context:
+    cluster: b
+    user: u
+`
+
+func TestRESTConfigContext(t *testing.T) {
+	c := Cluster{MetaData: MetaData{KubeConfig: testKubeConfig}}
+	config, err := c.RESTConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "https://a.example.com" {
+		t.Fatalf("expected current-context host, got %s", config.Host)
+	}
+
+	c.MetaData.Context = "b"
+	config, err = c.RESTConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "https://b.example.com" || config.BearerToken != "kubeconfig-token" {
+		t.Fatalf("unexpected config for context b: %s %s", config.Host, config.BearerToken)
+	}
+}
+
+func TestRESTConfigServerToken(t *testing.T) {
+	c := Cluster{MetaData: MetaData{Auth: Auth{
+		Server:   "https://c.example.com",
+		Token:    "token",
+		CAData:   "ca",
+		QPS:      50,
+		Burst:    100,
+		Timeout:  time.Second,
+		ProxyURL: "http://proxy:3128",
+		Exec:     &ExecConfig{Command: "get-token", Env: map[string]string{"B": "2", "A": "1"}},
+	}}}
+	config, err := c.RESTConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "https://c.example.com" || config.BearerToken != "token" || string(config.CAData) != "ca" {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+	if config.QPS != 50 || config.Burst != 100 || config.Timeout != time.Second {
+		t.Fatalf("unexpected client settings: %v %v %v", config.QPS, config.Burst, config.Timeout)
+	}
+	req, _ := http.NewRequest(http.MethodGet, config.Host, nil)
+	proxy, err := config.Proxy(req)
+	if err != nil || proxy.Host != "proxy:3128" {
+		t.Fatalf("unexpected proxy: %v %v", proxy, err)
+	}
+	if config.ExecProvider.APIVersion != defaultExecAPIVersion || config.ExecProvider.Env[0].Name != "A" {
+		t.Fatalf("unexpected exec provider: %+v", config.ExecProvider)
+	}
+
+	c.MetaData.Insecure = true
+	config, err = c.RESTConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Insecure || config.CAData != nil {
+		t.Fatal("insecure config should drop CA")
+	}
+}
+
+func TestRESTConfigInvalid(t *testing.T) {
+	cases := []MetaData{
+		{},
+		{Auth: Auth{Server: "https://c.example.com", CertFile: "cert.pem"}},
+		{Auth: Auth{Server: "https://c.example.com", Exec: &ExecConfig{}}},
+		{Auth: Auth{Server: "https://c.example.com", ProxyURL: "://bad"}},
+	}
+	for i, m := range cases {
+		c := Cluster{MetaData: m}
+		if _, err := c.RESTConfig(); err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+	}
+}
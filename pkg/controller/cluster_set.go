@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterSet 按集群标签选择一组集群，为其统一加入资源列表，避免在每个集群下重复配置 list
+type ClusterSet struct {
+	// Selector 集群标签选择器，如 env=prod,region in (eu-west-1)，为空时选择所有集群
+	Selector string `json:"selector" yaml:"selector"`
+	// List 被选中的集群额外监听的资源
+	List []ResourceAndNamespace `json:"list" yaml:"list"`
+}
+
+// WithClusterSets 按集群标签为集群加入资源列表，对运行时加入的集群同样生效
+func WithClusterSets(sets ...ClusterSet) Option {
+	return func(c *Controller) {
+		c.ClusterSets = append(c.ClusterSets, sets...)
+	}
+}
+
+// resourcesFor 返回集群最终监听的资源：集群自身的 list 加上所有匹配的 ClusterSet 的 list
+// 资源类型与 namespace 相同时，集群自身的配置优先
+func (c *Controller) resourcesFor(cluster Cluster) ([]ResourceAndNamespace, error) {
+	list := make([]ResourceAndNamespace, 0, len(cluster.MetaData.List))
+	seen := make(map[string]struct{})
+	add := func(r ResourceAndNamespace) {
+		key := r.RType + "/" + r.Namespace
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		list = append(list, r)
+	}
+	for _, r := range cluster.MetaData.List {
+		add(r)
+	}
+
+	clusterLabels := labels.Set(cluster.MetaData.Labels)
+	for i, set := range c.ClusterSets {
+		selector, err := labels.Parse(set.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("clusterSets[%d] invalid selector: %v", i, err)
+		}
+		if !selector.Matches(clusterLabels) {
+			continue
+		}
+		for _, r := range set.List {
+			add(r)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestResourcesFor(t *testing.T) {
+	c := &Controller{ClusterSets: []ClusterSet{
+		{Selector: "env=prod", List: []ResourceAndNamespace{{RType: "pods", Namespace: "all"}, {RType: "deployments", Namespace: "all"}}},
+		{Selector: "", List: []ResourceAndNamespace{{RType: "services", Namespace: "default"}}},
+	}}
+
+	prod := Cluster{MetaData: MetaData{
+		Labels: map[string]string{"env": "prod"},
+		List:   []ResourceAndNamespace{{RType: "pods", Namespace: "all", ObjSave: true}},
+	}}
+	list, err := c.resourcesFor(prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || !list[0].ObjSave || list[1].RType != "deployments" || list[2].RType != "services" {
+		t.Fatalf("unexpected prod resources: %+v", list)
+	}
+
+	list, err = c.resourcesFor(Cluster{MetaData: MetaData{Labels: map[string]string{"env": "dev"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].RType != "services" {
+		t.Fatalf("unexpected dev resources: %+v", list)
+	}
+
+	c.ClusterSets = []ClusterSet{{Selector: "env in (prod"}}
+	if _, err = c.resourcesFor(prod); err == nil {
+		t.Fatal("expected invalid selector error")
+	}
+}
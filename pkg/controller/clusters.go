@@ -0,0 +1,358 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sort"
+	"sync"
+	"time"
+)
+
+// clusterEntry 单个集群的运行时：客户端、informer 与本地缓存
+type clusterEntry struct {
+	name    string
+	cluster Cluster
+	client  *kubernetes.Clientset
+	// labels 集群标签，格式为 k1=v1,k2=v2
+	labels string
+	// logger 带有 cluster 字段
+	logger logr.Logger
+
+	// mu 保护以下字段，暂停、恢复集群时会重建 informer 与缓存
+	mu        sync.Mutex
+	informers InformerList
+	store     queue.MapIndexers
+	// stopC 关闭时只停止该集群的informer
+	stopC chan struct{}
+	// health 健康检查状态
+	health clusterHealth
+	// cancel 停止该集群的健康检查与informer
+	cancel context.CancelFunc
+	// owned 是否已在当前副本启动，开启分片时不负责的集群不启动
+	owned bool
+	// buildErr 创建informer失败的原因，如 all namespace 时列出 namespace 失败，启动时返回该错误
+	buildErr error
+}
+
+// AddCluster 加入集群，控制器已运行时立即启动informer，缓存同步在后台等待
+func (c *Controller) AddCluster(cluster Cluster) error {
+	name := cluster.MetaData.ClusterName
+	c.mu.RLock()
+	_, exists := c.clusters[name]
+	c.mu.RUnlock()
+	if exists {
+		return fmt.Errorf("cluster [%v] already exists", name)
+	}
+
+	e, err := c.newClusterEntry(cluster)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if _, exists = c.clusters[name]; exists {
+		c.mu.Unlock()
+		return fmt.Errorf("cluster [%v] already exists", name)
+	}
+	c.clusters[name] = e
+	ctx := c.runCtx
+	c.mu.Unlock()
+	c.indexers.Set(name, e.store)
+	c.indexers.SetLabels(name, e.cluster.MetaData.Labels)
+
+	e.logger.Info("add cluster")
+	c.startClusterAsync(ctx, e)
+	return nil
+}
+
+// UpdateCluster 替换集群配置：新建客户端、informer与缓存后替换旧的，再停止旧的
+// 适用于资源列表变化或凭证轮换，新的informer会重新 list，所有对象都会再产生一次 add 事件，
+// 旧缓存不会保留，替换期间被删除的对象不会产生 delete 事件，handler 需要幂等
+func (c *Controller) UpdateCluster(cluster Cluster) error {
+	name := cluster.MetaData.ClusterName
+	e, err := c.newClusterEntry(cluster)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old, ok := c.clusters[name]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("cluster [%v] not found", name)
+	}
+	c.clusters[name] = e
+	delete(c.failedClusters, name)
+	ctx := c.runCtx
+	c.mu.Unlock()
+
+	e.logger.Info("update cluster")
+	old.shutdown()
+	c.indexers.Set(name, e.store)
+	c.indexers.SetLabels(name, e.cluster.MetaData.Labels)
+	c.startClusterAsync(ctx, e)
+	return nil
+}
+
+// RemoveCluster 移除集群：停止informer与健康检查，并从本地缓存中删除
+// emitDelete 为 true 时，为该集群缓存中的所有对象放入 delete 事件，放入时对象已不在缓存中
+func (c *Controller) RemoveCluster(name string, emitDelete bool) error {
+	c.mu.Lock()
+	e, ok := c.clusters[name]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("cluster [%v] not found", name)
+	}
+	delete(c.clusters, name)
+	delete(c.failedClusters, name)
+	c.mu.Unlock()
+
+	e.logger.Info("remove cluster")
+	store := e.shutdown()
+	c.indexers.Delete(name)
+
+	if emitDelete {
+		c.pushStoreEvents(e, store, queue.EventDelete)
+	}
+	return nil
+}
+
+// startClusterAsync 控制器运行中时在后台启动集群，同步失败时记录到 failedClusters
+func (c *Controller) startClusterAsync(ctx context.Context, e *clusterEntry) {
+	if ctx == nil || ctx.Err() != nil {
+		return
+	}
+	// 开启分片时只启动当前副本负责的集群
+	if !c.ownsCluster(e.name) {
+		return
+	}
+	// 启动前同步标记，goroutine 执行前再次 rebalance 时不会重复启动
+	e.mu.Lock()
+	e.owned = true
+	e.mu.Unlock()
+	go func() {
+		err := c.startCluster(ctx, e)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		e.logger.Error(err, "cluster failed to sync, running in degraded mode")
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// 集群可能已被替换或移除
+		if c.clusters[e.name] == e {
+			c.failedClusters[e.name] = err
+		}
+	}()
+}
+
+// startCluster 启动集群的健康检查与informer，并等待缓存同步
+func (c *Controller) startCluster(ctx context.Context, e *clusterEntry) error {
+	ctx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.cancel = cancel
+	e.owned = true
+	e.mu.Unlock()
+	if c.HealthCheck != nil {
+		go c.monitorHealth(ctx, e)
+	}
+	return e.start(ctx.Done(), c.CacheSyncTimeout)
+}
+
+// pushStoreEvents 为集群缓存中的所有对象放入 event 事件
+func (c *Controller) pushStoreEvents(e *clusterEntry, store queue.MapIndexers, event string) {
+	objSave := make(map[string]bool)
+	for _, r := range e.cluster.MetaData.List {
+		objSave[r.RType] = objSave[r.RType] || r.ObjSave
+	}
+	for rType, indexers := range store {
+		for _, indexer := range indexers {
+			for _, obj := range indexer.List() {
+				key, err := cache.MetaNamespaceKeyFunc(obj)
+				if err != nil {
+					continue
+				}
+				qo := queue.QueueObject{ClusterName: e.name, ClusterLabels: e.labels, Event: event, ResourceType: rType, Key: key, CreateAt: time.Now()}
+				if objSave[rType] {
+					qo.Obj = obj
+				}
+				c.ingest(qo, predicate.Event{ClusterName: e.name, ClusterLabels: e.cluster.MetaData.Labels, ResourceType: rType, EventType: event, Object: obj})
+			}
+		}
+	}
+}
+
+// newClusterEntry 创建集群客户端，并为配置的每个资源创建 informer 与 indexer
+func (c *Controller) newClusterEntry(cluster Cluster) (*clusterEntry, error) {
+	list, err := c.resourcesFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	cluster.MetaData.List = list
+	client, err := cluster.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	e := &clusterEntry{
+		name:    cluster.MetaData.ClusterName,
+		cluster: cluster,
+		client:  client,
+		labels:  labels.Set(cluster.MetaData.Labels).String(),
+		logger:  c.Logger.WithValues("cluster", cluster.MetaData.ClusterName),
+		health:  clusterHealth{Healthy: true},
+	}
+	e.build(c.Queue, c.ingest, c.CacheSyncTimeout)
+	return e, nil
+}
+
+// build 创建 informer 与 indexer，会替换已有的，返回新的缓存
+// timeout 大于 0 时限制 all namespace 列出 namespace 的时间，失败时记录到 buildErr，其他资源的informer照常创建
+func (e *clusterEntry) build(worker queue.Queue, ingest IngestFunc, timeout time.Duration) queue.MapIndexers {
+	store := make(queue.MapIndexers)
+	informers := make(InformerList, 0)
+	var buildErr error
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 遍历所有资源，建立 indexer
+	for _, r := range e.cluster.MetaData.List {
+		r := r
+		r.clusterLabels = e.labels
+		r.logger = e.logger.WithValues("resource", r.RType)
+		// 当 namespace 为all时 单独处理
+		if r.Namespace == queue.All {
+			var indexerListRes []cache.Indexer
+			var informerListRes []cache.Controller
+			var err error
+			switch r.RType {
+			case queue.Deployments, queue.Statefulsets, queue.Daemonsets:
+				indexerListRes, informerListRes, err = r.CreateAllAppsV1IndexInformer(ctx, e.client, worker, e.name, ingest)
+			case queue.Pods, queue.ConfigMaps, queue.Secrets, queue.Services, queue.Events:
+				indexerListRes, informerListRes, err = r.CreateAllCoreV1IndexInformer(ctx, e.client, worker, e.name, ingest)
+			}
+			if err != nil {
+				e.logger.Error(err, "create informers for all namespaces failed", "resource", r.RType)
+				if buildErr == nil {
+					buildErr = fmt.Errorf("create [%v] informers: %w", r.RType, err)
+				}
+				continue
+			}
+			for k, v := range indexerListRes {
+				store[r.RType] = append(store[r.RType], v)
+				informers = append(informers, informerListRes[k])
+			}
+			continue
+		}
+
+		var indexer cache.Indexer
+		var informer cache.Controller
+		switch r.RType {
+		case queue.Deployments, queue.Statefulsets, queue.Daemonsets:
+			indexer, informer = r.CreateAppsV1IndexInformer(e.client, worker, e.name, ingest)
+		case queue.Pods, queue.ConfigMaps, queue.Secrets, queue.Services, queue.Events:
+			indexer, informer = r.CreateCoreV1IndexInformer(e.client, worker, e.name, ingest)
+		}
+		if informer == nil {
+			e.logger.Info("unsupported resource type, skip", "resource", r.RType)
+			continue
+		}
+		// 放入 list中
+		store[r.RType] = append(store[r.RType], indexer)
+		informers = append(informers, informer)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.store = store
+	e.informers = informers
+	e.buildErr = buildErr
+	return store
+}
+
+// start 启动该集群的informer，并等待缓存同步
+// done 或 stop 任一关闭时informer停止；部分informer创建失败时，其余的照常运行，直接返回创建失败的原因
+func (e *clusterEntry) start(done <-chan struct{}, timeout time.Duration) error {
+	e.mu.Lock()
+	stopC := make(chan struct{})
+	e.stopC = stopC
+	informers := e.informers
+	buildErr := e.buildErr
+	e.mu.Unlock()
+
+	merged := make(chan struct{})
+	go func() {
+		defer close(merged)
+		select {
+		case <-done:
+		case <-stopC:
+		}
+	}()
+	if buildErr != nil {
+		go func() { _ = informers.run(merged, timeout) }()
+		return buildErr
+	}
+	return informers.run(merged, timeout)
+}
+
+// stop 停止该集群的informer，可重复调用
+func (e *clusterEntry) stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopC != nil {
+		close(e.stopC)
+		e.stopC = nil
+	}
+}
+
+// shutdown 停止该集群的健康检查与informer，返回最后的缓存
+func (e *clusterEntry) shutdown() queue.MapIndexers {
+	e.mu.Lock()
+	cancel := e.cancel
+	store := e.store
+	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	e.stop()
+	return store
+}
+
+// isOwned 是否已在当前副本启动
+func (e *clusterEntry) isOwned() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.owned
+}
+
+// informerList 返回当前的informer list
+func (e *clusterEntry) informerList() InformerList {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.informers
+}
+
+// clusterList 按集群名排序返回所有集群
+func (c *Controller) clusterList() []*clusterEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clusterListLocked()
+}
+
+// clusterListLocked 同 clusterList，调用方需持有 c.mu
+func (c *Controller) clusterListLocked() []*clusterEntry {
+	res := make([]*clusterEntry, 0, len(c.clusters))
+	for _, e := range c.clusters {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
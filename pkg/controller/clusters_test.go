@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func testCluster(name string, labels map[string]string) Cluster {
+	return Cluster{MetaData: MetaData{
+		ClusterName: name,
+		Labels:      labels,
+		Auth:        Auth{Server: "https://" + name + ".example.com"},
+		List:        []ResourceAndNamespace{{RType: queue.Pods, Namespace: "default", ObjSave: true}},
+	}}
+}
+
+// addPod 直接写入集群缓存，模拟informer同步到的对象
+func addPod(t *testing.T, c *Controller, cluster string, name string) {
+	t.Helper()
+	store, ok := c.indexers.Cluster(cluster)
+	if !ok {
+		t.Fatalf("cluster %s not in store", cluster)
+	}
+	if err := store[queue.Pods][0].Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddRemoveCluster(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.AddCluster(testCluster("cluster1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.AddCluster(testCluster("cluster1", nil)); err == nil {
+		t.Fatal("expected error for duplicate cluster")
+	}
+	addPod(t, c, "cluster1", "a")
+
+	// 不放入 delete 事件
+	if err = c.RemoveCluster("cluster1", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.indexers.Cluster("cluster1"); ok || c.Queue.(*queue.Wq).Len() != 0 {
+		t.Fatal("removed cluster should leave no cache and no events")
+	}
+	if err = c.RemoveCluster("cluster1", false); err == nil {
+		t.Fatal("expected error for unknown cluster")
+	}
+
+	// 放入 delete 事件，事件带有缓存中的最后状态
+	if err = c.AddCluster(testCluster("cluster1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	addPod(t, c, "cluster1", "a")
+	if err = c.RemoveCluster("cluster1", true); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := c.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Event != queue.EventDelete || obj.ClusterName != "cluster1" || obj.Key != "default/a" || obj.Obj == nil {
+		t.Fatalf("unexpected delete event: %+v", obj)
+	}
+}
+
+func TestUpdateCluster(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.UpdateCluster(testCluster("cluster1", nil)); err == nil {
+		t.Fatal("expected error for unknown cluster")
+	}
+	if err = c.AddCluster(testCluster("cluster1", map[string]string{"env": "dev"})); err != nil {
+		t.Fatal(err)
+	}
+	addPod(t, c, "cluster1", "a")
+	old := c.clusters["cluster1"]
+
+	if err = c.UpdateCluster(testCluster("cluster1", map[string]string{"env": "prod"})); err != nil {
+		t.Fatal(err)
+	}
+	e := c.clusters["cluster1"]
+	if e == old || e.labels != "env=prod" {
+		t.Fatalf("cluster should be replaced, labels %q", e.labels)
+	}
+	// 旧缓存不保留，新 informer 重新 list
+	if keys := c.indexers.ListKeys(queue.Pods); len(keys) != 0 {
+		t.Fatalf("cache should be rebuilt, got %v", keys)
+	}
+}
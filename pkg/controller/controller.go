@@ -3,28 +3,64 @@ package controller
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/practice/multi_cluster_informer/pkg/metrics"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
 	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/practice/multi_cluster_informer/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // MultiClusterInformer 多集群informer的接口对象
 type MultiClusterInformer interface {
-	// Run 执行多集群的informer的方法
-	Run()
-	// Stop 停止informer
+	// Run 执行多集群的informer的方法，阻塞直到 ctx 结束或调用 Stop
+	Run(ctx context.Context) error
+	// Stop 停止informer，可重复调用
 	Stop()
-	// AddEventHandler 加入回调handler
-	AddEventHandler(handler HandleFunc)
+	// AddEventHandler 加入回调handler，可附带只对该handler生效的断言
+	AddEventHandler(handler HandleFunc, predicates ...predicate.Predicate)
+	// AddEventFilter 加入全局断言，对所有handler生效
+	AddEventFilter(predicates ...predicate.Predicate)
+	// Use 加入handler中间件
+	Use(middlewares ...Middleware)
+	// AddReconciler 加入调和器，与 handler 共用同一个队列，同一对象的多个事件合并为一次调和
+	AddReconciler(r Reconciler)
 	// HandleObject 调用handler处理资源对象
 	HandleObject(object queue.QueueObject) error
+	// AddCluster 运行时加入集群，控制器已运行时立即启动该集群的informer
+	AddCluster(cluster Cluster) error
+	// UpdateCluster 运行时替换集群配置，如资源列表变化或凭证轮换
+	UpdateCluster(cluster Cluster) error
+	// RemoveCluster 运行时移除集群，emitDelete 为 true 时为该集群缓存中的所有对象放入 delete 事件
+	RemoveCluster(name string, emitDelete bool) error
+	// FailedClusters 返回缓存同步失败的集群及原因，控制器以降级模式运行
+	FailedClusters() map[string]error
+	// IsLeader 当前副本是否为 leader，未开启选主时总是 true
+	IsLeader() bool
+	// ShardMembers 返回当前存活的分片成员，未开启分片时返回空
+	ShardMembers() []string
+	// MetricsHandler 返回 Prometheus 格式的指标
+	MetricsHandler() http.Handler
+	// HTTPHandler 返回健康检查、就绪检查、指标与调试接口
+	HTTPHandler() http.Handler
+	// HasSynced 所有informer是否都已同步
+	HasSynced() bool
+	// Status 返回每个集群、每个informer的同步状态
+	Status() []ClusterStatus
 	// Queue 队列接口对象
 	queue.Queue
 	// Store 本地缓存接口对象
@@ -34,46 +70,172 @@ type MultiClusterInformer interface {
 // Controller 控制器
 // 主要保存所有集群的客户端实例，并保存
 type Controller struct {
-	// clients 多客户端 list
-	clients []*kubernetes.Clientset
-	// Informers 多个informer list
-	Informers InformerList
-	// HandleFunc 统一的handle方法
-	HandleFunc HandleFunc
+	// clusters 集群名 -> 集群的客户端、informer 与缓存
+	clusters map[string]*clusterEntry
+	// indexers 多集群本地缓存，与 Store 是同一个对象
+	indexers *queue.ClusterIndexers
+	// mu 保护 clusters failedClusters runCtx
+	mu sync.RWMutex
+	// handlers 回调handler列表
+	handlers []handlerEntry
+	// predicates 全局断言，在入队前执行
+	predicates []predicate.Predicate
+	// Reconciler 调和器，不关心事件类型，只关心对象
+	Reconciler Reconciler
+	// middlewares handler 中间件链
+	middlewares []Middleware
+	// handlerMu 保护 handlers predicates Reconciler middlewares，每个事件入队时都会读取，与集群的锁分开
+	handlerMu sync.RWMutex
+	// matched 需要处理该对象的handler下标，没有记录时所有handler都处理
+	// 入队时只有部分handler匹配、或处理失败只需重试部分handler时记录，Finish、丢弃或关闭队列时清理
+	matched map[queue.QueueObject][]int
+	// matchedMu 保护 matched
+	matchedMu sync.Mutex
 	// Queue 一个工作队列: 多集群的所有资源都会放入此队列
 	queue.Queue
 	// Store 一个本地缓存：多集群的所有资源都会放入此缓存
 	queue.Store
-	// stop chan
+	// stop chan，Stop 时关闭
 	StopC chan struct{}
+	// stopOnce 保证 StopC 只关闭一次
+	stopOnce sync.Once
+	// DrainTimeout 大于 0 时，停止前最多等待该时间让正在处理的对象完成
+	DrainTimeout time.Duration
+	// CacheSyncTimeout 大于 0 时，每个集群最多等待该时间完成缓存同步，超时的集群不阻塞启动
+	CacheSyncTimeout time.Duration
+	// failedClusters 缓存同步失败的集群及原因
+	failedClusters map[string]error
+	// HealthCheck 不为空时对每个集群做健康检查
+	HealthCheck *HealthCheck
+	// ClusterSets 按集群标签统一加入的资源列表
+	ClusterSets []ClusterSet
+	// TracerProvider 创建 ingest 与 handle span 使用的 TracerProvider，为空时使用 otel 全局的
+	TracerProvider trace.TracerProvider
+	// QueueName 工作队列名，作为 workqueue 指标的 name 标签，为空时自动生成进程内唯一的名称
+	QueueName string
+	// LeaderElection 不为空时开启选主
+	LeaderElection *LeaderElection
+	// leading 为 1 时当前副本是 leader
+	leading int32
+	// leaderC 第一次成为 leader 时关闭，未开启选主时创建后立即关闭
+	leaderC    chan struct{}
+	leaderOnce sync.Once
+	// leaderLost 为 1 时因失去 leader 身份而停止
+	leaderLost int32
+	// Sharding 不为空时开启分片，每个副本只启动自己负责的集群
+	Sharding *Sharding
+	// shardMu 保护 ring
+	shardMu sync.RWMutex
+	// ring 按存活的分片成员建立的哈希环，尚未获取成员时为空
+	ring *hashRing
+	// HTTPServer 不为空时随控制器一起启动 HTTP 服务
+	HTTPServer *HTTPServer
+	// runCtx Run 运行期间的 ctx，未运行时为空
+	runCtx context.Context
+	// runnables 随控制器一起运行的后台任务
+	runnables []Runnable
+	// Logger 日志，默认使用 klog，集群、informer、队列与 handler 的日志都从它派生
+	Logger logr.Logger
+	// metricsRegistry 该控制器的informer状态指标，第一次调用 MetricsHandler 时创建
+	metricsRegistry *prometheus.Registry
+	metricsOnce     sync.Once
+}
+
+// NewController 创建控制器，并为每个集群创建客户端、informer 与本地缓存
+func NewController(maxReQueueTime int, clusters []Cluster, opts ...Option) (*Controller, error) {
+	indexers := queue.NewClusterIndexers()
+	c := &Controller{
+		Store:    indexers,
+		indexers: indexers,
+		clusters: make(map[string]*clusterEntry),
+		StopC:    make(chan struct{}),
+		Logger:   klog.Background(),
+
+		failedClusters: make(map[string]error),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// 选项可能指定队列名，所以在选项之后创建队列
+	if c.QueueName != "" {
+		c.Queue = queue.NewNamedWorkQueue(maxReQueueTime, c.QueueName)
+	} else {
+		c.Queue = queue.NewWorkQueue(maxReQueueTime)
+	}
+	c.leaderC = make(chan struct{})
+	if c.LeaderElection == nil {
+		c.leaderOnce.Do(func() { close(c.leaderC) })
+	}
+	if wq, ok := c.Queue.(*queue.Wq); ok {
+		wq.Logger = c.Logger.WithName("queue")
+	}
+
+	// 遍历所有集群，并初始化
+	for _, cluster := range clusters {
+		e, err := c.newClusterEntry(cluster)
+		if err != nil {
+			return nil, err
+		}
+		c.clusters[e.name] = e
+		c.indexers.Set(e.name, e.store)
+		c.indexers.SetLabels(e.name, e.cluster.MetaData.Labels)
+	}
+	if le := c.LeaderElection; le != nil && le.Client == nil {
+		if _, ok := c.clusters[le.HomeCluster]; !ok {
+			return nil, fmt.Errorf("leader election home cluster [%v] not found", le.HomeCluster)
+		}
+	}
+	if s := c.Sharding; s != nil && s.Client == nil {
+		if _, ok := c.clusters[s.HomeCluster]; !ok {
+			return nil, fmt.Errorf("sharding home cluster [%v] not found", s.HomeCluster)
+		}
+	}
+	return c, nil
 }
 
 // 是否实现MultiClusterInformer接口
 var _ MultiClusterInformer = &Controller{}
 
+// IngestFunc 接收informer事件，由实现者过滤并放入队列
+type IngestFunc func(qo queue.QueueObject, e predicate.Event)
+
 // initHandle 处理informer逻辑
-// 执行的逻辑：当监听到新增、修改、删除事件时，放入工作队列中
-func initHandle(resource string, worker queue.Queue, clusterName string, isObjSave bool) cache.ResourceEventHandlerFuncs {
+// 执行的逻辑：当监听到新增、修改、删除事件时，交给 ingest 过滤并放入工作队列，ingest 为空时直接放入 worker
+// update 事件会先经过 r.UpdateFilter 抑制
+func initHandle(resource string, worker queue.Queue, clusterName string, r ResourceAndNamespace, ingest IngestFunc) cache.ResourceEventHandlerFuncs {
+	clusterLabels, _ := labels.ConvertSelectorToLabelsMap(r.clusterLabels)
+	push := func(qo queue.QueueObject, e predicate.Event) {
+		qo.ClusterLabels = r.clusterLabels
+		e.ClusterLabels = clusterLabels
+		if ingest == nil {
+			worker.Push(qo)
+			return
+		}
+		ingest(qo, e)
+	}
 	handler := cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err == nil {
 				qo := queue.QueueObject{ClusterName: clusterName, Event: queue.EventAdd, ResourceType: resource, Key: key, CreateAt: time.Now()}
-				if isObjSave {
+				if r.ObjSave {
 					qo.Obj = obj
 				}
-				worker.Push(qo)
+				push(qo, predicate.Event{ClusterName: clusterName, ResourceType: resource, EventType: queue.EventAdd, Object: obj})
 			}
 		},
 		UpdateFunc: func(old interface{}, new interface{}) {
+			if r.UpdateFilter.suppress(r.log(), old, new) {
+				return
+			}
 			key, err := cache.MetaNamespaceKeyFunc(new)
 			if err == nil {
 				qo := queue.QueueObject{ClusterName: clusterName, Event: queue.EventUpdate, ResourceType: resource, Key: key, CreateAt: time.Now()}
-				if isObjSave {
+				if r.ObjSave {
 					qo.Obj = new
 				}
 				// 放入
-				worker.Push(qo)
+				push(qo, predicate.Event{ClusterName: clusterName, ResourceType: resource, EventType: queue.EventUpdate, Object: new, OldObject: old})
 
 			}
 		},
@@ -82,56 +244,445 @@ func initHandle(resource string, worker queue.Queue, clusterName string, isObjSa
 			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 			if err == nil {
 				qo := queue.QueueObject{ClusterName: clusterName, Event: queue.EventDelete, ResourceType: resource, Key: key, CreateAt: time.Now()}
-				if isObjSave {
+				if r.ObjSave {
 					qo.Obj = obj
 				}
-				worker.Push(qo)
+				push(qo, predicate.Event{ClusterName: clusterName, ResourceType: resource, EventType: queue.EventDelete, Object: obj})
 			}
 		},
 	}
 	return handler
 }
 
-// Run 执行informer
-func (c *Controller) Run() {
-	klog.Info("run controller...")
-	defer c.Queue.Close()
-	c.Informers.run(c.StopC)
-	<-c.StopC
+// Run 执行informer，阻塞直到 ctx 结束或调用 Stop
+// informer 缓存同步失败时返回错误，正常停止时返回 nil；返回时控制器视为已停止，阻塞在 Pop 上的 follower 随之返回
+func (c *Controller) Run(ctx context.Context) error {
+	c.Logger.Info("run controller")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer c.Stop()
+	// 后台任务通过 LoggerFrom(ctx) 获取控制器的 logger
+	ctx = klog.NewContext(ctx, c.Logger)
+	go func() {
+		select {
+		case <-c.StopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer c.shutdown()
+
+	// 记录运行时的 ctx 并在同一临界区内取集群列表：之前加入的集群由 Run 启动，之后 AddCluster 加入的集群直接启动
+	c.mu.Lock()
+	c.runCtx = ctx
+	clusters := c.clusterListLocked()
+	c.mu.Unlock()
+	// 先启动 HTTP 服务，等待缓存同步期间 /readyz 返回未就绪
+	if c.HTTPServer != nil {
+		served, err := c.startHTTPServer(ctx)
+		if err != nil {
+			return fmt.Errorf("start http server: %v", err)
+		}
+		defer func() {
+			cancel()
+			<-served
+		}()
+	}
+	for _, r := range c.runnables {
+		go r(ctx)
+	}
+
+	// 开启分片时先登记成员，只启动当前副本负责的集群
+	var sharded chan struct{}
+	if c.Sharding != nil {
+		client, err := c.shardClient()
+		if err != nil {
+			return err
+		}
+		c.initShards(ctx, client)
+		owned := clusters[:0:0]
+		for _, e := range clusters {
+			if c.ownsCluster(e.name) {
+				owned = append(owned, e)
+			}
+		}
+		clusters = owned
+		c.Logger.Info("sharding clusters", "identity", c.Sharding.Identity, "owned", len(clusters))
+		sharded = make(chan struct{})
+		go func() {
+			defer close(sharded)
+			c.runSharding(ctx, client)
+		}()
+		// 等待删除自己的 Lease，其他副本可以立即接管
+		defer func() {
+			cancel()
+			<-sharded
+		}()
+	}
+
+	failed := c.runInformers(ctx, clusters)
+	// 启动过程中被停止不算错误
+	if ctx.Err() != nil {
+		return nil
+	}
+	if len(failed) > 0 && len(failed) == len(clusters) {
+		return fmt.Errorf("all clusters failed to sync: %v", failed)
+	}
+	for name, err := range failed {
+		c.Logger.Error(err, "cluster failed to sync, running in degraded mode", "cluster", name)
+	}
+	// 缓存同步后再参与选主，成为 leader 时缓存已预热
+	var elected chan struct{}
+	if c.LeaderElection != nil {
+		elected = make(chan struct{})
+		go func() {
+			defer close(elected)
+			c.runLeaderElection(ctx)
+		}()
+	}
+	<-ctx.Done()
+	// 等待释放 Lease，其他副本无需等到 Lease 过期即可接替
+	if elected != nil {
+		<-elected
+	}
+	if atomic.LoadInt32(&c.leaderLost) == 1 {
+		return ErrLeaderElectionLost
+	}
+	return nil
+}
+
+// runInformers 并发启动所有集群的informer，每个集群单独等待缓存同步
+// 同步失败的集群不阻塞其他集群，其informer继续运行并自行重试
+func (c *Controller) runInformers(ctx context.Context, clusters []*clusterEntry) map[string]error {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	failed := make(map[string]error)
+	for _, e := range clusters {
+		wg.Add(1)
+		go func(e *clusterEntry) {
+			defer wg.Done()
+			if err := c.startCluster(ctx, e); err != nil {
+				lock.Lock()
+				failed[e.name] = err
+				lock.Unlock()
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	for name, err := range failed {
+		c.failedClusters[name] = err
+	}
+	c.mu.Unlock()
+	return failed
+}
+
+// FailedClusters 返回缓存同步失败的集群及原因
+func (c *Controller) FailedClusters() map[string]error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make(map[string]error, len(c.failedClusters))
+	for k, v := range c.failedClusters {
+		res[k] = v
+	}
+	return res
 }
 
 // Stop 停止
 func (c *Controller) Stop() {
-	c.StopC <- struct{}{}
+	c.stopOnce.Do(func() {
+		close(c.StopC)
+	})
+}
+
+// shutdown 关闭队列，设置了 DrainTimeout 时先等待正在处理的对象完成
+func (c *Controller) shutdown() {
+	defer c.resetMatched()
+	if c.DrainTimeout <= 0 {
+		c.Queue.Close()
+		return
+	}
+	c.Logger.Info("draining queue", "timeout", c.DrainTimeout)
+	drained := make(chan struct{})
+	go func() {
+		c.Queue.Drain()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(c.DrainTimeout):
+		c.Logger.Info("drain queue timeout, force shutdown")
+		c.Queue.Close()
+	}
+}
+
+// HandleFunc 回调方法，ctx 由中间件传递（超时、取消等）
+type HandleFunc func(ctx context.Context, object queue.QueueObject) error
+
+// handlerEntry handler 及其专属断言
+type handlerEntry struct {
+	fn         HandleFunc
+	predicates []predicate.Predicate
+	// index 加入顺序，作为 handler 日志的 handler 字段
+	index int
+}
+
+// AddEventHandler 加入handler，predicates 只对该handler生效
+// 所有handler的断言都不通过的事件不会进入队列
+func (c *Controller) AddEventHandler(handler HandleFunc, predicates ...predicate.Predicate) {
+	c.handlerMu.Lock()
+	defer c.handlerMu.Unlock()
+	c.handlers = append(c.handlers, handlerEntry{fn: handler, predicates: predicates, index: len(c.handlers)})
+}
+
+// AddEventFilter 加入全局断言
+func (c *Controller) AddEventFilter(predicates ...predicate.Predicate) {
+	c.handlerMu.Lock()
+	defer c.handlerMu.Unlock()
+	c.predicates = append(c.predicates, predicates...)
+}
+
+// ingest 作为 IngestFunc 传给 informer 回调，经过 enqueue 过滤后放入队列
+// follower 不放入事件，避免队列无限增长，成为 leader 时重放缓存
+func (c *Controller) ingest(qo queue.QueueObject, e predicate.Event) {
+	metrics.EventsReceived.WithLabelValues(qo.ClusterName, qo.ResourceType, qo.Event).Inc()
+	if !c.IsLeader() {
+		return
+	}
+	if !c.enqueue(qo, e) {
+		metrics.EventsFiltered.WithLabelValues(qo.ClusterName, qo.ResourceType, qo.Event).Inc()
+	}
+}
+
+// enqueue 过滤事件并放入队列，返回 false 时事件被过滤
+// 有handler匹配时放入事件，只有部分handler匹配时记录匹配的handler，分发时只调用这些handler；
+// 设置了 Reconciler 时另外放入该对象的调和请求，集群事件不放入调和请求
+func (c *Controller) enqueue(qo queue.QueueObject, e predicate.Event) bool {
+	matched, handle, reconcile := c.match(e)
+	if qo.ResourceType == queue.Cluster {
+		reconcile = false
+	}
+	if !handle && !reconcile {
+		return false
+	}
+	// 只为通过过滤的事件创建 ingest span，匹配信息以带 TraceParent 的 qo 为 key，所以先设置
+	ctx, span := c.tracer().Start(context.Background(), "ingest "+qo.ResourceType,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(tracing.Attributes(qo.ClusterName, qo.ResourceType, qo.Key, qo.Event)...))
+	defer span.End()
+	qo.TraceParent = tracing.Inject(ctx)
+	if handle {
+		if matched != nil {
+			c.setMatched(qo, matched)
+		}
+		c.Queue.Push(qo)
+	}
+	if reconcile {
+		c.Queue.Push(reconcileObject(qo))
+	}
+	return true
+}
+
+// tracer 返回控制器使用的 tracer，未设置 TracerProvider 时使用 otel 全局的 tracer
+func (c *Controller) tracer() trace.Tracer {
+	if c.TracerProvider != nil {
+		return c.TracerProvider.Tracer(tracing.InstrumentationName)
+	}
+	return tracing.Tracer()
+}
+
+// match 执行全局断言与各handler的专属断言
+// handle 表示是否需要放入事件，没有handler也没有 Reconciler 时事件由调用方自行处理，同样放入；
+// 所有handler都匹配时 matched 为 nil，否则为匹配的handler下标；reconcile 表示是否需要放入调和请求
+func (c *Controller) match(e predicate.Event) (matched []int, handle, reconcile bool) {
+	c.handlerMu.RLock()
+	defer c.handlerMu.RUnlock()
+	if !predicate.All(c.predicates, e) {
+		return nil, false, false
+	}
+	reconcile = c.Reconciler != nil
+	if len(c.handlers) == 0 {
+		return nil, !reconcile, reconcile
+	}
+	matched = make([]int, 0, len(c.handlers))
+	for i, h := range c.handlers {
+		if predicate.All(h.predicates, e) {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == len(c.handlers) {
+		return nil, true, reconcile
+	}
+	return matched, len(matched) > 0, reconcile
+}
+
+// setMatched 记录需要处理 obj 的handler
+func (c *Controller) setMatched(obj queue.QueueObject, matched []int) {
+	c.matchedMu.Lock()
+	defer c.matchedMu.Unlock()
+	if c.matched == nil {
+		c.matched = make(map[queue.QueueObject][]int)
+	}
+	c.matched[obj] = matched
+}
+
+// handlersFor 返回需要处理 obj 的handler
+func (c *Controller) handlersFor(obj queue.QueueObject) []handlerEntry {
+	c.matchedMu.Lock()
+	matched, ok := c.matched[obj]
+	c.matchedMu.Unlock()
+
+	c.handlerMu.RLock()
+	defer c.handlerMu.RUnlock()
+	if !ok {
+		return append([]handlerEntry(nil), c.handlers...)
+	}
+	res := make([]handlerEntry, 0, len(matched))
+	for _, i := range matched {
+		res = append(res, c.handlers[i])
+	}
+	return res
+}
+
+// forgetMatched 对象不再处理时清理匹配记录
+func (c *Controller) forgetMatched(obj queue.QueueObject) {
+	c.matchedMu.Lock()
+	defer c.matchedMu.Unlock()
+	delete(c.matched, obj)
+}
+
+// resetMatched 关闭队列后清理所有匹配记录，队列中未取出的对象不会再被处理
+func (c *Controller) resetMatched() {
+	c.matchedMu.Lock()
+	defer c.matchedMu.Unlock()
+	c.matched = nil
+}
+
+// Finish 完成处理，同时清理匹配记录
+func (c *Controller) Finish(obj queue.QueueObject) {
+	c.forgetMatched(obj)
+	c.Queue.Finish(obj)
+}
+
+// ReQueue 重新放入队列，超过最大次数被丢弃时清理匹配记录
+func (c *Controller) ReQueue(obj queue.QueueObject) error {
+	err := c.Queue.ReQueue(obj)
+	observeRequeue(obj, err)
+	if err != nil {
+		c.forgetMatched(obj)
+	}
+	return err
 }
 
-type HandleFunc func(object queue.QueueObject) error
+// ReQueueAfter 延迟重新放入队列，超过最大次数被丢弃时清理匹配记录
+func (c *Controller) ReQueueAfter(obj queue.QueueObject, d time.Duration) error {
+	err := c.Queue.ReQueueAfter(obj, d)
+	observeRequeue(obj, err)
+	if err != nil {
+		c.forgetMatched(obj)
+	}
+	return err
+}
 
-func (c *Controller) AddEventHandler(handler HandleFunc) {
-	c.HandleFunc = handler
+// ReQueueAt 在指定时间重新放入队列，超过最大次数被丢弃时清理匹配记录
+func (c *Controller) ReQueueAt(obj queue.QueueObject, t time.Time) error {
+	err := c.Queue.ReQueueAt(obj, t)
+	observeRequeue(obj, err)
+	if err != nil {
+		c.forgetMatched(obj)
+	}
+	return err
 }
 
 // HandleObject 自定义回调方法
+// handler 可以返回 queue.RetryAfter 构造的错误，调用方据此使用 ReQueueAfter 延迟重试，
+// 返回 queue.Permanent 构造的错误时，调用方应直接 Finish
+// 使用 Tracing 中间件时，处理时的 span 与入队时的 ingest span 建立 link
 func (c *Controller) HandleObject(obj queue.QueueObject) error {
-	if c.HandleFunc != nil {
-		err := c.HandleFunc(obj)
-		return err
+	start := time.Now()
+	ctx := klog.NewContext(context.Background(), objectLogger(c.Logger, obj))
+	ctx = tracing.NewContext(ctx, c.tracer())
+	c.handlerMu.RLock()
+	middlewares := c.middlewares
+	c.handlerMu.RUnlock()
+	err := chain(middlewares, c.dispatch)(ctx, obj)
+	observeHandle(obj, start, err)
+	return err
+}
+
+// dispatch 中间件链的最内层，调和请求交给 Reconciler，其他事件依次调用匹配的handler，某个handler失败不影响之后的handler
+// 有handler失败时记录失败的handler，重新入列后只重试这些handler；
+// 返回第一个可重试的错误，都是 queue.Permanent 错误时返回第一个
+func (c *Controller) dispatch(ctx context.Context, obj queue.QueueObject) error {
+	logger := LoggerFrom(ctx)
+	if obj.Event == queue.EventReconcile {
+		c.handlerMu.RLock()
+		reconciler := c.Reconciler
+		c.handlerMu.RUnlock()
+		if reconciler == nil {
+			return nil
+		}
+		return c.reconcile(klog.NewContext(ctx, logger.WithName("reconciler")), reconciler, obj)
 	}
-	return nil
+
+	var failed []int
+	var retryErr, permanentErr error
+	for _, h := range c.handlersFor(obj) {
+		err := h.fn(klog.NewContext(ctx, logger.WithValues("handler", h.index)), obj)
+		switch {
+		case err == nil:
+		case queue.IsPermanent(err):
+			if permanentErr == nil {
+				permanentErr = err
+			}
+		default:
+			failed = append(failed, h.index)
+			if retryErr == nil {
+				retryErr = err
+			}
+		}
+	}
+	if retryErr != nil {
+		c.setMatched(obj, failed)
+		return retryErr
+	}
+	return permanentErr
 }
 
 type InformerList []cache.Controller
 
-func (s InformerList) run(done chan struct{}) {
-	// 执行所有list 中的informer
+// ErrCacheSync 等待informer缓存同步失败
+var ErrCacheSync = errors.New("等待内部缓存超时")
+
+// run 并发执行所有list 中的informer，timeout 大于 0 时最多等待该时间完成缓存同步
+func (s InformerList) run(done <-chan struct{}, timeout time.Duration) error {
+	synced := make([]cache.InformerSynced, 0, len(s))
 	for _, one := range s {
 		// 使用不同goroutine执行 informer
 		go one.Run(done)
+		synced = append(synced, one.HasSynced)
+	}
 
-		if !cache.WaitForCacheSync(done, one.HasSynced) {
-			panic("等待内部缓存超时")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 超时 context 派生自 ctx，done 关闭时同样结束等待
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return ErrCacheSync
 	}
+	return nil
 }
 
 // ResourceAndNamespace 资源与namespace
@@ -139,118 +690,122 @@ type ResourceAndNamespace struct {
 	RType     string `json:"rType" yaml:"rType"`
 	Namespace string `json:"namespace" yaml:"namespace"`
 	ObjSave   bool   `json:"objSave" yaml:"objSave"`
+	// UpdateFilter update 事件抑制，为空时不抑制
+	UpdateFilter *UpdateFilter `json:"updateFilter" yaml:"updateFilter"`
+
+	// clusterLabels 所属集群的标签，构造 informer 时由集群填入
+	clusterLabels string
+	// logger 带有 cluster、resource 字段，构造 informer 时由集群填入
+	logger logr.Logger
 }
 
 // MetaData 集群对象所需的信息
 type MetaData struct {
 	List        []ResourceAndNamespace `json:"list" yaml:"list"`
 	ConfigPath  string                 `json:"configPath" yaml:"configPath"` // kube config文件
+	KubeConfig  string                 `json:"kubeConfig" yaml:"kubeConfig"` // kube config文件内容，如从 Secret 中读取
 	Insecure    bool                   `json:"insecure" yaml:"insecure"`     // 是否跳过证书认证
 	ClusterName string                 `json:"clusterName" yaml:"clusterName"`
+	// Labels 集群标签，如 env=prod、region=eu-west-1，可被 ClusterSet 与断言选择
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	// Auth 其他认证方式与客户端参数，见 auth.go
+	Auth `json:",inline" yaml:",inline"`
 }
 
 // CreateCoreV1IndexInformer 构造informer需要的资源
-func (r *ResourceAndNamespace) CreateCoreV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) (indexer cache.Indexer, informer cache.Controller) {
-	lw := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), r.RType, r.Namespace, fields.Everything())
-	switch r.RType {
-	case queue.Services:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Service{}, 0, initHandle(queue.Services, worker, clusterName, r.ObjSave), cache.Indexers{})
-	case queue.Pods:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Pod{}, 0, initHandle(queue.Pods, worker, clusterName, r.ObjSave), cache.Indexers{})
-	case queue.ConfigMaps:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.ConfigMap{}, 0, initHandle(queue.ConfigMaps, worker, clusterName, r.ObjSave), cache.Indexers{})
-	case queue.Secrets:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Secret{}, 0, initHandle(queue.Secrets, worker, clusterName, r.ObjSave), cache.Indexers{})
-	case queue.Events:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Event{}, 0, initHandle(queue.Events, worker, clusterName, r.ObjSave), cache.Indexers{})
-	}
-	return
+func (r *ResourceAndNamespace) CreateCoreV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string, ingest IngestFunc) (indexer cache.Indexer, informer cache.Controller) {
+	return r.newCoreV1IndexInformer(client, worker, clusterName, r.Namespace, ingest)
 }
 
 // CreateAppsV1IndexInformer 构造informer需要的资源
-func (r *ResourceAndNamespace) CreateAppsV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) (indexer cache.Indexer, informer cache.Controller) {
-	lw := cache.NewListWatchFromClient(client.AppsV1().RESTClient(), r.RType, r.Namespace, fields.Everything())
-	switch r.RType {
-	case queue.Deployments:
-		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, initHandle(queue.Deployments, worker, clusterName, r.ObjSave), cache.Indexers{})
-	case queue.Statefulsets:
-		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, initHandle(queue.Statefulsets, worker, clusterName, r.ObjSave), cache.Indexers{})
-	case queue.Daemonsets:
-		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, initHandle(queue.Daemonsets, worker, clusterName, r.ObjSave), cache.Indexers{})
-	}
-	return
+func (r *ResourceAndNamespace) CreateAppsV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string, ingest IngestFunc) (indexer cache.Indexer, informer cache.Controller) {
+	return r.newAppsV1IndexInformer(client, worker, clusterName, r.Namespace, ingest)
 }
 
 // CreateAllCoreV1IndexInformer 创建选项是 all namespace时的解决方法
-func (r *ResourceAndNamespace) CreateAllCoreV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) ([]cache.Indexer, []cache.Controller) {
+// 列出 namespace 失败时返回错误，调用方应将集群标记为同步失败；ctx 用于限制列出 namespace 的时间
+func (r *ResourceAndNamespace) CreateAllCoreV1IndexInformer(ctx context.Context, client *kubernetes.Clientset, worker queue.Queue, clusterName string, ingest IngestFunc) ([]cache.Indexer, []cache.Controller, error) {
 	// 1. 先查一下所有ns
-	nsList, err := client.CoreV1().Namespaces().List(context.Background(), v12.ListOptions{})
+	nsList, err := client.CoreV1().Namespaces().List(ctx, v12.ListOptions{})
 	if err != nil {
-		return nil, nil
+		return nil, nil, fmt.Errorf("list namespaces: %w", err)
 	}
 	// 2. 遍历所有ns，并创建informer，存入list中，返回
 	var indexerListRes = make([]cache.Indexer, 0)
 	var informerListRes = make([]cache.Controller, 0)
 	// 让所有ns都初始化indexers informer
 	for _, v := range nsList.Items {
-		klog.Infof("informer all [%v] namespace, namespace: [%v]", r.RType, v.Name)
-		lw := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), r.RType, v.Namespace, fields.Everything())
-		switch r.RType {
-		case queue.Services:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Service{}, 0, initHandle(queue.Services, worker, clusterName, r.ObjSave), cache.Indexers{})
-			informerListRes = append(informerListRes, informer)
-			indexerListRes = append(indexerListRes, indexer)
-		case queue.Pods:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Pod{}, 0, initHandle(queue.Pods, worker, clusterName, r.ObjSave), cache.Indexers{})
-			informerListRes = append(informerListRes, informer)
-			indexerListRes = append(indexerListRes, indexer)
-		case queue.ConfigMaps:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.ConfigMap{}, 0, initHandle(queue.ConfigMaps, worker, clusterName, r.ObjSave), cache.Indexers{})
-			informerListRes = append(informerListRes, informer)
-			indexerListRes = append(indexerListRes, indexer)
-		case queue.Events:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Event{}, 0, initHandle(queue.Events, worker, clusterName, r.ObjSave), cache.Indexers{})
-			informerListRes = append(informerListRes, informer)
-			indexerListRes = append(indexerListRes, indexer)
-		case queue.Secrets:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Secret{}, 0, initHandle(queue.Secrets, worker, clusterName, r.ObjSave), cache.Indexers{})
+		r.log().Info("informer all namespace", "namespace", v.Name)
+		indexer, informer := r.newCoreV1IndexInformer(client, worker, clusterName, v.Name, ingest)
+		if informer != nil {
 			informerListRes = append(informerListRes, informer)
 			indexerListRes = append(indexerListRes, indexer)
 		}
 	}
-	return indexerListRes, informerListRes
+	return indexerListRes, informerListRes, nil
 }
 
 // CreateAllAppsV1IndexInformer 创建选项是 all namespace 时的解决方法
-func (r *ResourceAndNamespace) CreateAllAppsV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) ([]cache.Indexer, []cache.Controller) {
+// 列出 namespace 失败时返回错误，调用方应将集群标记为同步失败；ctx 用于限制列出 namespace 的时间
+func (r *ResourceAndNamespace) CreateAllAppsV1IndexInformer(ctx context.Context, client *kubernetes.Clientset, worker queue.Queue, clusterName string, ingest IngestFunc) ([]cache.Indexer, []cache.Controller, error) {
 	// 1. 先查一下所有 ns
-	nsList, err := client.CoreV1().Namespaces().List(context.Background(), v12.ListOptions{})
+	nsList, err := client.CoreV1().Namespaces().List(ctx, v12.ListOptions{})
 	if err != nil {
-		return nil, nil
+		return nil, nil, fmt.Errorf("list namespaces: %w", err)
 	}
 	// 2. 遍历所有 ns，并创建 informer，存入 list 中，返回
 	var indexerListRes = make([]cache.Indexer, 0)
 	var informerListRes = make([]cache.Controller, 0)
 	// 让所有 ns 都初始化 indexers informer
 	for _, v := range nsList.Items {
-		klog.Infof("informer all [%v] namespace, namespace: [%v]", r.RType, v.Name)
-		lw := cache.NewListWatchFromClient(client.AppsV1().RESTClient(), r.RType, v.Namespace, fields.Everything())
-		switch r.RType {
-		case queue.Deployments:
-			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, initHandle(queue.Deployments, worker, clusterName, r.ObjSave), cache.Indexers{})
-			informerListRes = append(informerListRes, informer)
-			indexerListRes = append(indexerListRes, indexer)
-		case queue.Statefulsets:
-			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.StatefulSet{}, 0, initHandle(queue.Statefulsets, worker, clusterName, r.ObjSave), cache.Indexers{})
-			informerListRes = append(informerListRes, informer)
-			indexerListRes = append(indexerListRes, indexer)
-		case queue.Daemonsets:
-			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.DaemonSet{}, 0, initHandle(queue.Daemonsets, worker, clusterName, r.ObjSave), cache.Indexers{})
+		r.log().Info("informer all namespace", "namespace", v.Name)
+		indexer, informer := r.newAppsV1IndexInformer(client, worker, clusterName, v.Name, ingest)
+		if informer != nil {
 			informerListRes = append(informerListRes, informer)
 			indexerListRes = append(indexerListRes, indexer)
 		}
 	}
-	return indexerListRes, informerListRes
+	return indexerListRes, informerListRes, nil
+}
+
+// newCoreV1IndexInformer 在指定 namespace 下构造 core/v1 资源的informer，不支持的资源类型返回 nil
+func (r *ResourceAndNamespace) newCoreV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string, namespace string, ingest IngestFunc) (cache.Indexer, cache.Controller) {
+	var objType runtime.Object
+	switch r.RType {
+	case queue.Services:
+		objType = &v1.Service{}
+	case queue.Pods:
+		objType = &v1.Pod{}
+	case queue.ConfigMaps:
+		objType = &v1.ConfigMap{}
+	case queue.Secrets:
+		objType = &v1.Secret{}
+	case queue.Events:
+		objType = &v1.Event{}
+	default:
+		return nil, nil
+	}
+	lw, stats := newTrackedListWatch(client.CoreV1().RESTClient(), r.RType, namespace)
+	indexer, informer := cache.NewIndexerInformer(lw, objType, 0, initHandle(r.RType, worker, clusterName, *r, ingest), cache.Indexers{})
+	return indexer, &trackedInformer{Controller: informer, indexer: indexer, stats: stats, resource: r.RType, namespace: namespace}
+}
+
+// newAppsV1IndexInformer 在指定 namespace 下构造 apps/v1 资源的informer，不支持的资源类型返回 nil
+func (r *ResourceAndNamespace) newAppsV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string, namespace string, ingest IngestFunc) (cache.Indexer, cache.Controller) {
+	var objType runtime.Object
+	switch r.RType {
+	case queue.Deployments:
+		objType = &appsv1.Deployment{}
+	case queue.Statefulsets:
+		objType = &appsv1.StatefulSet{}
+	case queue.Daemonsets:
+		objType = &appsv1.DaemonSet{}
+	default:
+		return nil, nil
+	}
+	lw, stats := newTrackedListWatch(client.AppsV1().RESTClient(), r.RType, namespace)
+	indexer, informer := cache.NewIndexerInformer(lw, objType, 0, initHandle(r.RType, worker, clusterName, *r, ingest), cache.Indexers{})
+	return indexer, &trackedInformer{Controller: informer, indexer: indexer, stats: stats, resource: r.RType, namespace: namespace}
 }
 
 // Cluster 集群对象
@@ -260,18 +815,9 @@ type Cluster struct {
 
 // NewClient 初始化client
 func (c *Cluster) NewClient() (*kubernetes.Clientset, error) {
-
-	if c.MetaData.ConfigPath != "" {
-		config, err := clientcmd.BuildConfigFromFlags("", c.MetaData.ConfigPath)
-		if err != nil {
-			return nil, err
-		}
-		config.Insecure = c.MetaData.Insecure
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			return nil, err
-		}
-		return clientset, nil
+	config, err := c.RESTConfig()
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("无法找到集群client端")
+	return kubernetes.NewForConfig(config)
 }
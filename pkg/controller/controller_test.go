@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFilterEventRouting(t *testing.T) {
+	c, err := NewController(3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddEventFilter(predicate.Not(predicate.NamespaceMatches(regexp.MustCompile(`^kube-`))))
+	calls := make([]int, 2)
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		calls[0]++
+		return nil
+	})
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		calls[1]++
+		return nil
+	}, predicate.EventTypeIn(queue.EventDelete))
+	handle := initHandle(queue.Pods, c, "cluster1", ResourceAndNamespace{}, c.ingest)
+
+	// 全局断言不通过，不入队
+	handle.OnAdd(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "a"}})
+	if c.Queue.(*queue.Wq).Len() != 0 {
+		t.Fatalf("filtered event should not be queued, got %d", c.Queue.(*queue.Wq).Len())
+	}
+
+	// add 事件只有第一个handler匹配，delete 事件两个handler都匹配
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}
+	handle.OnAdd(pod)
+	handle.OnDelete(pod)
+	for i := 0; i < 2; i++ {
+		obj, err := c.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.HandleObject(obj); err != nil {
+			t.Fatal(err)
+		}
+		c.Finish(obj)
+	}
+	if calls[0] != 2 || calls[1] != 1 {
+		t.Fatalf("unexpected handler calls: %v", calls)
+	}
+	if len(c.matched) != 0 {
+		t.Fatalf("matched records should be cleaned after Finish, got %v", c.matched)
+	}
+}
+
+func TestDispatchRequeuesFailedHandlers(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := make([]int, 3)
+	failed := errors.New("failed")
+	for i := range calls {
+		i := i
+		c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+			calls[i]++
+			// 第二个handler只在第一次失败
+			if i == 1 && calls[i] == 1 {
+				return failed
+			}
+			return nil
+		})
+	}
+
+	c.Push(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Event: queue.EventAdd, Key: "default/a"})
+	obj, _ := c.Pop()
+	if err = c.HandleObject(obj); !errors.Is(err, failed) {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if err = c.ReQueue(obj); err != nil {
+		t.Fatal(err)
+	}
+	obj, _ = c.Pop()
+	if err = c.HandleObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	c.Finish(obj)
+	// 失败后所有handler都已执行，重试时只调用失败的handler
+	if calls[0] != 1 || calls[1] != 2 || calls[2] != 1 {
+		t.Fatalf("unexpected handler calls: %v", calls)
+	}
+
+	// 超过最大次数被丢弃时同样清理记录
+	calls[1] = 0
+	c.Push(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Event: queue.EventAdd, Key: "default/b"})
+	obj, _ = c.Pop()
+	_ = c.HandleObject(obj)
+	_ = c.ReQueue(obj)
+	obj, _ = c.Pop()
+	calls[1] = 0
+	_ = c.HandleObject(obj)
+	if err = c.ReQueue(obj); !errors.Is(err, queue.ErrMaxReQueue) {
+		t.Fatalf("expected ErrMaxReQueue, got %v", err)
+	}
+	if len(c.matched) != 0 {
+		t.Fatalf("matched records should be cleaned after drop, got %v", c.matched)
+	}
+}
+
+// runController 在后台运行控制器，返回 Run 的结果
+func runController(t *testing.T, c *Controller) <-chan error {
+	t.Helper()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.Run(context.Background())
+	}()
+	return errC
+}
+
+func waitRun(t *testing.T, errC <-chan error, timeout time.Duration) {
+	t.Helper()
+	select {
+	case err := <-errC:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("Run did not return")
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := runController(t, c)
+	c.Stop()
+	c.Stop()
+	waitRun(t, errC, time.Second)
+	if _, err = c.Pop(); err == nil {
+		t.Fatal("queue should be closed after Run returns")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c, err := NewController(1, nil, WithDrainTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Push(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Key: "default/a"})
+	obj, _ := c.Pop()
+
+	errC := runController(t, c)
+	c.Stop()
+	// 正在处理的对象完成前 Run 不返回
+	select {
+	case <-errC:
+		t.Fatal("Run returned before the in-flight object finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Finish(obj)
+	waitRun(t, errC, time.Second)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	c, err := NewController(1, nil, WithDrainTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Push(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Key: "default/a"})
+	_, _ = c.Pop()
+
+	// 对象一直未完成，超时后强制关闭
+	start := time.Now()
+	errC := runController(t, c)
+	c.Stop()
+	waitRun(t, errC, time.Second)
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("Run returned before the drain timeout: %v", d)
+	}
+}
+
+// fakeInformer 运行至 stop 关闭，同步状态固定的informer
+type fakeInformer struct {
+	syncedInformer
+}
+
+func (f fakeInformer) Run(stop <-chan struct{}) {
+	<-stop
+}
+
+func TestInformerSyncTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	if err := (InformerList{fakeInformer{syncedInformer{synced: true}}}).run(done, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := (InformerList{fakeInformer{}}).run(done, 50*time.Millisecond); !errors.Is(err, ErrCacheSync) {
+		t.Fatalf("expected ErrCacheSync, got %v", err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("returned before the timeout: %v", d)
+	}
+
+	// 未设置超时时 done 关闭后结束等待
+	stop := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() {
+		errC <- (InformerList{fakeInformer{}}).run(stop, 0)
+	}()
+	close(stop)
+	select {
+	case err := <-errC:
+		if !errors.Is(err, ErrCacheSync) {
+			t.Fatalf("expected ErrCacheSync, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return after done closed")
+	}
+}
+
+func TestDegradedMode(t *testing.T) {
+	c, err := NewController(1, nil, WithCacheSyncTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.clusters["good"] = &clusterEntry{name: "good", informers: InformerList{fakeInformer{syncedInformer{synced: true}}}, health: clusterHealth{Healthy: true}}
+	c.clusters["bad"] = &clusterEntry{name: "bad", informers: InformerList{fakeInformer{}}, health: clusterHealth{Healthy: true}}
+	errC := runController(t, c)
+
+	// 同步失败的集群不阻塞启动，记录到 FailedClusters
+	deadline := time.Now().Add(time.Second)
+	for len(c.FailedClusters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	failed := c.FailedClusters()
+	if len(failed) != 1 || !errors.Is(failed["bad"], ErrCacheSync) {
+		t.Fatalf("unexpected failed clusters: %v", failed)
+	}
+	select {
+	case err = <-errC:
+		t.Fatalf("Run should keep running in degraded mode, got %v", err)
+	default:
+	}
+	c.Stop()
+	waitRun(t, errC, time.Second)
+
+	// 所有集群都失败时 Run 返回错误
+	c, err = NewController(1, nil, WithCacheSyncTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.clusters["bad"] = &clusterEntry{name: "bad", informers: InformerList{fakeInformer{}}, health: clusterHealth{Healthy: true}}
+	select {
+	case err = <-runController(t, c):
+		if err == nil {
+			t.Fatal("expected error when all clusters failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return")
+	}
+}
+
+func TestAllNamespaceListFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	cluster := Cluster{MetaData: MetaData{
+		ClusterName: "cluster1",
+		Auth:        Auth{Server: srv.URL},
+		List:        []ResourceAndNamespace{{RType: queue.Pods, Namespace: queue.All}},
+	}}
+	c, err := NewController(1, []Cluster{cluster}, WithCacheSyncTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 列出 namespace 失败的集群标记为同步失败，而不是没有informer的已同步集群
+	select {
+	case err = <-runController(t, c):
+		if err == nil {
+			t.Fatal("expected error when the only cluster failed to list namespaces")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if failed := c.FailedClusters(); failed["cluster1"] == nil {
+		t.Fatalf("cluster should be marked failed, got %v", failed)
+	}
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"time"
+)
+
+// HealthCheck 集群健康检查配置
+type HealthCheck struct {
+	// Interval 探测间隔，默认 10s
+	Interval time.Duration `json:"interval" yaml:"interval"`
+	// Timeout 单次探测超时，默认 5s
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// FailureThreshold 连续失败多少次标记为不健康，默认 3
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// PauseInformers 不健康时暂停该集群的informer，恢复后重建informer与缓存
+	PauseInformers bool `json:"pauseInformers" yaml:"pauseInformers"`
+}
+
+func (h HealthCheck) withDefaults() HealthCheck {
+	if h.Interval <= 0 {
+		h.Interval = 10 * time.Second
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = 5 * time.Second
+	}
+	if h.FailureThreshold <= 0 {
+		h.FailureThreshold = 3
+	}
+	return h
+}
+
+// clusterHealth 集群健康状态，由 clusterEntry.mu 保护
+type clusterHealth struct {
+	Healthy             bool
+	Paused              bool
+	ConsecutiveFailures int
+	LastProbeTime       time.Time
+	LastProbeError      error
+}
+
+// probe 请求集群的 /readyz
+func (e *clusterEntry) probe(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return e.client.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+}
+
+// monitorHealth 定期探测集群，连续失败达到阈值时标记为不健康，恢复时重新标记为健康
+// 状态变化时放入 cluster-unhealthy / cluster-recovered 事件
+func (c *Controller) monitorHealth(ctx context.Context, e *clusterEntry) {
+	hc := c.HealthCheck.withDefaults()
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := e.probe(ctx, hc.Timeout)
+		if ctx.Err() != nil {
+			return
+		}
+
+		e.mu.Lock()
+		h := &e.health
+		h.LastProbeTime = time.Now()
+		h.LastProbeError = err
+		var event string
+		if err != nil {
+			h.ConsecutiveFailures++
+			if h.Healthy && h.ConsecutiveFailures >= hc.FailureThreshold {
+				h.Healthy = false
+				event = queue.EventClusterUnhealthy
+			}
+		} else {
+			h.ConsecutiveFailures = 0
+			if !h.Healthy {
+				h.Healthy = true
+				event = queue.EventClusterRecovered
+			}
+		}
+		e.mu.Unlock()
+
+		switch event {
+		case queue.EventClusterUnhealthy:
+			e.logger.Error(err, "cluster is unhealthy")
+			if hc.PauseInformers {
+				c.pauseCluster(e)
+			}
+			c.pushClusterEvent(e, event)
+		case queue.EventClusterRecovered:
+			e.logger.Info("cluster recovered")
+			if hc.PauseInformers {
+				c.resumeCluster(ctx.Done(), e)
+			}
+			c.pushClusterEvent(e, event)
+		}
+	}
+}
+
+// pauseCluster 停止集群的informer，缓存保留最后的状态
+func (c *Controller) pauseCluster(e *clusterEntry) {
+	e.stop()
+	e.mu.Lock()
+	e.health.Paused = true
+	e.mu.Unlock()
+}
+
+// resumeCluster 重建集群的informer与缓存并重新启动
+// 重建后会重新 list，所有对象都会再产生一次 add 事件
+func (c *Controller) resumeCluster(done <-chan struct{}, e *clusterEntry) {
+	e.mu.Lock()
+	paused := e.health.Paused
+	e.health.Paused = false
+	e.mu.Unlock()
+	if !paused {
+		return
+	}
+	c.indexers.Set(e.name, e.build(c.Queue, c.ingest, c.CacheSyncTimeout))
+	go func() {
+		if err := e.start(done, c.CacheSyncTimeout); err != nil {
+			e.logger.Error(err, "cluster failed to sync after recovery")
+		}
+	}()
+}
+
+// pushClusterEvent 放入集群事件，与informer事件一样经过断言过滤、指标与追踪
+// 集群事件只交给 handler，不放入调和请求，只注册了 Reconciler 时被过滤
+func (c *Controller) pushClusterEvent(e *clusterEntry, event string) {
+	qo := queue.QueueObject{ClusterName: e.name, ClusterLabels: e.labels, Event: event, ResourceType: queue.Cluster, Key: e.name, CreateAt: time.Now()}
+	c.ingest(qo, predicate.Event{ClusterName: e.name, ClusterLabels: e.cluster.MetaData.Labels, ResourceType: queue.Cluster, EventType: event})
+}
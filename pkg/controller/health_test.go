@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"github.com/practice/multi_cluster_informer/pkg/metrics"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newProbeCluster 返回连接到测试服务器的集群，healthy 为 0 时 /readyz 返回 500
+func newProbeCluster(t *testing.T, c *Controller, healthy *int32) *clusterEntry {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	cluster := Cluster{MetaData: MetaData{ClusterName: "cluster1", Auth: Auth{Server: srv.URL}}}
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &clusterEntry{name: "cluster1", cluster: cluster, client: client, logger: c.Logger, health: clusterHealth{Healthy: true}}
+}
+
+func popEvent(t *testing.T, c *Controller) queue.QueueObject {
+	t.Helper()
+	objC := make(chan queue.QueueObject, 1)
+	go func() {
+		obj, _ := c.Pop()
+		objC <- obj
+	}()
+	select {
+	case obj := <-objC:
+		c.Finish(obj)
+		return obj
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event queued")
+		return queue.QueueObject{}
+	}
+}
+
+func TestHealthPauseResume(t *testing.T) {
+	c, err := NewController(1, nil, WithHealthCheck(HealthCheck{Interval: 10 * time.Millisecond, FailureThreshold: 2, PauseInformers: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var healthy int32
+	e := newProbeCluster(t, c, &healthy)
+	c.clusters[e.name] = e
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.monitorHealth(ctx, e)
+
+	// 连续失败达到阈值后暂停informer并放入集群事件
+	obj := popEvent(t, c)
+	if obj.Event != queue.EventClusterUnhealthy || obj.ResourceType != queue.Cluster || obj.Key != "cluster1" {
+		t.Fatalf("unexpected event: %+v", obj)
+	}
+	status := c.Status()[0]
+	if status.Healthy || !status.Paused || status.ConsecutiveFailures < 2 || status.LastProbeError == "" {
+		t.Fatalf("unexpected status after failures: %+v", status)
+	}
+
+	// 恢复后重建informer并放入恢复事件
+	atomic.StoreInt32(&healthy, 1)
+	if obj = popEvent(t, c); obj.Event != queue.EventClusterRecovered {
+		t.Fatalf("unexpected event: %+v", obj)
+	}
+	status = c.Status()[0]
+	if !status.Healthy || status.Paused || status.ConsecutiveFailures != 0 {
+		t.Fatalf("unexpected status after recovery: %+v", status)
+	}
+}
+
+func TestClusterEventIngest(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddEventFilter(predicate.EventTypeIn(queue.EventClusterUnhealthy))
+	e := &clusterEntry{name: "ingest-cluster", health: clusterHealth{Healthy: true}}
+	received := metrics.EventsReceived.WithLabelValues(e.name, queue.Cluster, queue.EventClusterRecovered)
+	filtered := metrics.EventsFiltered.WithLabelValues(e.name, queue.Cluster, queue.EventClusterRecovered)
+	receivedBefore, filteredBefore := testutil.ToFloat64(received), testutil.ToFloat64(filtered)
+
+	// 集群事件与informer事件一样经过断言过滤并计入指标
+	c.pushClusterEvent(e, queue.EventClusterRecovered)
+	if testutil.ToFloat64(received)-receivedBefore != 1 || testutil.ToFloat64(filtered)-filteredBefore != 1 {
+		t.Fatal("filtered cluster event should be counted")
+	}
+	c.pushClusterEvent(e, queue.EventClusterUnhealthy)
+	obj, err := c.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Event != queue.EventClusterUnhealthy || obj.ResourceType != queue.Cluster || obj.Key != e.name {
+		t.Fatalf("unexpected cluster event: %+v", obj)
+	}
+	if c.Queue.(*queue.Wq).Len() != 0 {
+		t.Fatal("cluster events should not produce other queue items")
+	}
+	c.Finish(obj)
+
+	// 只注册了 Reconciler 时集群事件不入队，需要 handler 接收
+	c.AddReconciler(ReconcileFunc(func(ctx context.Context, req Request) (Result, error) { return Result{}, nil }))
+	c.pushClusterEvent(e, queue.EventClusterUnhealthy)
+	if c.Queue.(*queue.Wq).Len() != 0 {
+		t.Fatal("cluster events should not be sent to reconcilers")
+	}
+}
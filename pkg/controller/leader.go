@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLeaderElectionLost 失去 leader 身份，控制器已停止，调用方应退出进程后重启
+var ErrLeaderElectionLost = errors.New("leader election lost")
+
+// ErrStoppedBeforeLeading 成为 leader 前控制器已停止，Pop 不再取出事件
+var ErrStoppedBeforeLeading = errors.New("controller stopped before becoming leader")
+
+// LeaderElection 基于 Lease 的选主：多副本时只有 leader 将事件放入队列并处理
+// follower 的 informer 照常运行以保持缓存预热，但不放入事件；成为 leader 时为缓存中的每个对象放入一次 add 事件，
+// follower 期间被删除的对象不会产生 delete 事件，handler 需要以缓存中的当前状态为准
+type LeaderElection struct {
+	// HomeCluster Lease 所在的集群名，必须是已配置的集群
+	HomeCluster string `json:"homeCluster" yaml:"homeCluster"`
+	// Namespace Lease 所在的 namespace，默认 default
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Name Lease 名称，默认 multi-cluster-informer
+	Name string `json:"name" yaml:"name"`
+	// Identity 当前副本的标识，默认 hostname_随机串
+	Identity string `json:"identity" yaml:"identity"`
+	// LeaseDuration follower 等待多久后可以抢占 leader，默认 15s
+	LeaseDuration time.Duration `json:"leaseDuration" yaml:"leaseDuration"`
+	// RenewDeadline leader 续约的超时时间，默认 10s
+	RenewDeadline time.Duration `json:"renewDeadline" yaml:"renewDeadline"`
+	// RetryPeriod 获取与续约的重试间隔，默认 2s
+	RetryPeriod time.Duration `json:"retryPeriod" yaml:"retryPeriod"`
+
+	// Client 创建 Lease 使用的客户端，为空时使用 HomeCluster 的客户端，测试时可传入 fake clientset
+	Client kubernetes.Interface `json:"-" yaml:"-"`
+}
+
+// WithDefaults 返回填充默认值后的配置
+func (le LeaderElection) WithDefaults() LeaderElection {
+	if le.Namespace == "" {
+		le.Namespace = "default"
+	}
+	if le.Name == "" {
+		le.Name = "multi-cluster-informer"
+	}
+	if le.Identity == "" {
+		hostname, _ := os.Hostname()
+		le.Identity = hostname + "_" + string(uuid.NewUUID())
+	}
+	if le.LeaseDuration <= 0 {
+		le.LeaseDuration = 15 * time.Second
+	}
+	if le.RenewDeadline <= 0 {
+		le.RenewDeadline = 10 * time.Second
+	}
+	if le.RetryPeriod <= 0 {
+		le.RetryPeriod = 2 * time.Second
+	}
+	return le
+}
+
+// WithLeaderElection 开启选主，只有 leader 放入并取出事件
+func WithLeaderElection(le LeaderElection) Option {
+	return func(c *Controller) {
+		le = le.WithDefaults()
+		c.LeaderElection = &le
+	}
+}
+
+// IsLeader 当前副本是否为 leader，未开启选主时总是 true
+func (c *Controller) IsLeader() bool {
+	return c.LeaderElection == nil || atomic.LoadInt32(&c.leading) == 1
+}
+
+// newLeaderElector 创建选主对象，Lease 创建在 HomeCluster 中
+func (c *Controller) newLeaderElector(ctx context.Context) (*leaderelection.LeaderElector, error) {
+	le := c.LeaderElection
+	client := le.Client
+	if client == nil {
+		c.mu.RLock()
+		e, ok := c.clusters[le.HomeCluster]
+		c.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("leader election home cluster [%v] not found", le.HomeCluster)
+		}
+		client = e.client
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: le.Namespace, Name: le.Name},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: le.Identity},
+	}
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   le.LeaseDuration,
+		RenewDeadline:   le.RenewDeadline,
+		RetryPeriod:     le.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            le.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				c.Logger.Info("started leading", "identity", le.Identity)
+				c.startedLeading()
+			},
+			OnStoppedLeading: func() {
+				atomic.StoreInt32(&c.leading, 0)
+				// ctx 结束时是正常退出
+				if ctx.Err() != nil {
+					return
+				}
+				c.Logger.Error(ErrLeaderElectionLost, "stop controller", "identity", le.Identity)
+				atomic.StoreInt32(&c.leaderLost, 1)
+				c.Stop()
+			},
+			OnNewLeader: func(identity string) {
+				if identity != le.Identity {
+					c.Logger.Info("new leader elected", "leader", identity)
+				}
+			},
+		},
+	})
+}
+
+// startedLeading 标记为 leader 后重放缓存，再放行 Pop
+// 先标记再重放，之间的informer事件直接入队，不会遗漏，与重放的 add 事件重复时由 handler 幂等处理
+func (c *Controller) startedLeading() {
+	atomic.StoreInt32(&c.leading, 1)
+	for _, e := range c.clusterList() {
+		e.mu.Lock()
+		store := e.store
+		e.mu.Unlock()
+		c.pushStoreEvents(e, store, queue.EventAdd)
+	}
+	c.leaderOnce.Do(func() { close(c.leaderC) })
+}
+
+// runLeaderElection 参与选主，直到 ctx 结束或失去 leader 身份
+func (c *Controller) runLeaderElection(ctx context.Context) {
+	elector, err := c.newLeaderElector(ctx)
+	if err != nil {
+		c.Logger.Error(err, "leader election failed")
+		atomic.StoreInt32(&c.leaderLost, 1)
+		c.Stop()
+		return
+	}
+	elector.Run(ctx)
+}
+
+// waitLeader 阻塞到成为 leader，返回 false 表示成为 leader 前控制器已停止
+func (c *Controller) waitLeader() bool {
+	select {
+	case <-c.leaderC:
+		return true
+	default:
+	}
+	select {
+	case <-c.leaderC:
+		return true
+	case <-c.StopC:
+		return false
+	}
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func newTestElector(t *testing.T, client *fake.Clientset, identity string) *Controller {
+	t.Helper()
+	c, err := NewController(1, nil, WithLeaderElection(LeaderElection{
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+		Client:        client,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestLeaderElection(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	a := newTestElector(t, client, "a")
+	b := newTestElector(t, client, "b")
+	if a.IsLeader() {
+		t.Fatal("should not be leader before running")
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan error)
+	go func() { doneA <- a.Run(ctxA) }()
+	waitFor(t, a.IsLeader, "a should become leader")
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go func() { _ = b.Run(ctxB) }()
+	time.Sleep(300 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("only one replica can be leader")
+	}
+
+	// a 退出时释放 Lease，b 接替
+	cancelA()
+	if err := <-doneA; err != nil {
+		t.Fatalf("unexpected error on normal stop: %v", err)
+	}
+	waitFor(t, b.IsLeader, "b should take over")
+
+	c, _ := NewController(1, nil)
+	if !c.IsLeader() {
+		t.Fatal("controller without leader election is always leader")
+	}
+}
+
+func TestFollowerReplaysStore(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c := newTestElector(t, client, "a")
+	if err := c.AddCluster(testCluster("cluster1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	addPod(t, c, "cluster1", "a")
+	// follower 不放入事件
+	c.ingest(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Event: queue.EventDelete, Key: "default/b"},
+		predicate.Event{ClusterName: "cluster1", ResourceType: queue.Pods, EventType: queue.EventDelete})
+	if n := c.Queue.(*queue.Wq).Len(); n != 0 {
+		t.Fatalf("follower queue length = %d, want 0", n)
+	}
+
+	objC := make(chan queue.QueueObject, 1)
+	go func() {
+		obj, _ := c.Pop()
+		objC <- obj
+	}()
+	select {
+	case obj := <-objC:
+		t.Fatalf("follower should not pop events, got %+v", obj)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 成为 leader 时为缓存中的对象放入 add 事件
+	c.startedLeading()
+	select {
+	case obj := <-objC:
+		if obj.Event != queue.EventAdd || obj.Key != "default/a" {
+			t.Fatalf("unexpected event: %+v", obj)
+		}
+		c.Finish(obj)
+	case <-time.After(5 * time.Second):
+		t.Fatal("leader should pop replayed events")
+	}
+	if n := c.Queue.(*queue.Wq).Len(); n != 0 {
+		t.Fatalf("queue length = %d, want 0", n)
+	}
+
+	// 成为 leader 前停止，Pop 返回错误
+	c = newTestElector(t, client, "b")
+	c.Stop()
+	if _, err := c.Pop(); !errors.Is(err, ErrStoppedBeforeLeading) {
+		t.Fatalf("expected ErrStoppedBeforeLeading, got %v", err)
+	}
+}
+
+func TestFollowerPopReturnsOnCancel(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	a := newTestElector(t, client, "a")
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	go func() { _ = a.Run(ctxA) }()
+	waitFor(t, a.IsLeader, "a should become leader")
+
+	b := newTestElector(t, client, "b")
+	ctxB, cancelB := context.WithCancel(context.Background())
+	doneB := make(chan error)
+	go func() { doneB <- b.Run(ctxB) }()
+	errC := make(chan error, 1)
+	go func() {
+		_, err := b.Pop()
+		errC <- err
+	}()
+	time.Sleep(300 * time.Millisecond)
+
+	// ctx 结束时 follower 的 Pop 返回，调用方可以退出取出循环
+	cancelB()
+	if err := <-doneB; err != nil {
+		t.Fatalf("unexpected error on normal stop: %v", err)
+	}
+	select {
+	case err := <-errC:
+		if !errors.Is(err, ErrStoppedBeforeLeading) {
+			t.Fatalf("expected ErrStoppedBeforeLeading, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower Pop should return after Run stops")
+	}
+}
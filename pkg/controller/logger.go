@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"k8s.io/klog/v2"
+)
+
+// WithLogger 使用自定义 logger，默认使用 klog
+// 集群、informer、队列与 handler 的日志都从该 logger 派生，并带上 cluster、resource、key 等字段
+func WithLogger(logger logr.Logger) Option {
+	return func(c *Controller) {
+		c.Logger = logger
+	}
+}
+
+// LoggerFrom 返回 ctx 中的 logger，ctx 中没有时返回 klog 的默认 logger
+// HandleFunc 与 Reconciler 收到的 ctx 中的 logger 已带有 cluster、resource、key、event 字段，
+// HandleFunc 的 logger 还带有 handler 字段，为 AddEventHandler 的加入顺序
+// Runnable 收到的 ctx 中为控制器的 logger
+func LoggerFrom(ctx context.Context) logr.Logger {
+	return klog.FromContext(ctx)
+}
+
+// objectLogger 返回带有对象字段的 logger
+func objectLogger(logger logr.Logger, obj queue.QueueObject) logr.Logger {
+	return logger.WithValues("cluster", obj.ClusterName, "resource", obj.ResourceType, "key", obj.Key, "event", obj.Event)
+}
+
+// log 返回informer使用的 logger，未通过 build 创建时使用 klog 的默认 logger
+func (r *ResourceAndNamespace) log() logr.Logger {
+	if r.logger.GetSink() == nil {
+		return klog.Background().WithValues("resource", r.RType)
+	}
+	return r.logger
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/go-logr/logr/funcr"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, prefix+" "+args)
+	}, funcr.Options{})
+
+	c, err := NewController(0, nil, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		return nil
+	})
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		LoggerFrom(ctx).Info("handled")
+		return errors.New("failed")
+	})
+
+	obj := queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Event: queue.EventAdd, Key: "default/a"}
+	c.Push(obj)
+	got, _ := c.Pop()
+	if err = c.HandleObject(got); err == nil {
+		t.Fatal("expected handler error")
+	}
+	// 最大重试次数为 0，直接被丢弃
+	_ = c.ReQueue(got)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		`"msg"="handled" "cluster"="cluster1" "resource"="pods" "key"="default/a" "event"="add" "handler"=1`,
+		`queue "level"=0 "msg"="drop object after max requeue times" "cluster"="cluster1" "resource"="pods" "key"="default/a" "event"="add"`,
+	}
+	for _, w := range want {
+		found := false
+		for _, line := range lines {
+			if strings.Contains(line, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing log %q in %q", w, lines)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/metrics"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+var (
+	informerSyncedDesc = prometheus.NewDesc(metrics.Namespace+"_informer_synced",
+		"Whether the informer has completed its initial sync (1) or not (0).",
+		[]string{"cluster", "resource", "namespace"}, nil)
+	informerWatchRestartsDesc = prometheus.NewDesc(metrics.Namespace+"_informer_watch_restarts",
+		"Number of times the informer re-established its watch since it was created.",
+		[]string{"cluster", "resource", "namespace"}, nil)
+	informerObjectsDesc = prometheus.NewDesc(metrics.Namespace+"_informer_objects",
+		"Number of objects in the informer's local cache.",
+		[]string{"cluster", "resource", "namespace"}, nil)
+	clusterHealthyDesc = prometheus.NewDesc(metrics.Namespace+"_cluster_healthy",
+		"Whether the cluster passed its health check (1) or not (0).",
+		[]string{"cluster"}, nil)
+)
+
+// statusCollector 抓取时从 Status 读取informer与集群状态
+// informer 会随集群的加入、移除、暂停而重建，所以不使用常驻的指标对象
+type statusCollector struct {
+	c *Controller
+}
+
+func (s statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- informerSyncedDesc
+	ch <- informerWatchRestartsDesc
+	ch <- informerObjectsDesc
+	ch <- clusterHealthyDesc
+}
+
+func (s statusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, cs := range s.c.Status() {
+		ch <- prometheus.MustNewConstMetric(clusterHealthyDesc, prometheus.GaugeValue, boolValue(cs.Healthy), cs.Name)
+		for _, is := range cs.Informers {
+			ch <- prometheus.MustNewConstMetric(informerSyncedDesc, prometheus.GaugeValue, boolValue(is.Synced), cs.Name, is.Resource, is.Namespace)
+			ch <- prometheus.MustNewConstMetric(informerWatchRestartsDesc, prometheus.GaugeValue, float64(is.WatchRestarts), cs.Name, is.Resource, is.Namespace)
+			ch <- prometheus.MustNewConstMetric(informerObjectsDesc, prometheus.GaugeValue, float64(is.ObjectCount), cs.Name, is.Resource, is.Namespace)
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// MetricsHandler 返回 Prometheus 格式的指标，包括全局的事件、队列、handler 指标与该控制器的informer状态
+func (c *Controller) MetricsHandler() http.Handler {
+	c.metricsOnce.Do(func() {
+		c.metricsRegistry = prometheus.NewRegistry()
+		c.metricsRegistry.MustRegister(statusCollector{c: c})
+	})
+	return promhttp.HandlerFor(prometheus.Gatherers{metrics.Registry, c.metricsRegistry}, promhttp.HandlerOpts{})
+}
+
+// Pop 取出队列，同时记录对象从产生到被取出的时间
+// 开启选主时阻塞到成为 leader，成为 leader 时缓存已重放到队列中
+func (c *Controller) Pop() (queue.QueueObject, error) {
+	if !c.waitLeader() {
+		return queue.QueueObject{}, ErrStoppedBeforeLeading
+	}
+	obj, err := c.Queue.Pop()
+	if err == nil && !obj.CreateAt.IsZero() {
+		metrics.QueueLatency.WithLabelValues(obj.ClusterName, obj.ResourceType).Observe(time.Since(obj.CreateAt).Seconds())
+	}
+	return obj, err
+}
+
+// observeRequeue 记录重新入列或超过最大次数被丢弃
+func observeRequeue(obj queue.QueueObject, err error) {
+	switch {
+	case err == nil:
+		metrics.Requeues.WithLabelValues(obj.ClusterName, obj.ResourceType).Inc()
+	case errors.Is(err, queue.ErrMaxReQueue):
+		metrics.DeadLetters.WithLabelValues(obj.ClusterName, obj.ResourceType).Inc()
+	}
+}
+
+// observeHandle 记录 HandleObject 的耗时与错误
+func observeHandle(obj queue.QueueObject, start time.Time, err error) {
+	metrics.HandlerDuration.WithLabelValues(obj.ClusterName, obj.ResourceType).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.HandlerErrors.WithLabelValues(obj.ClusterName, obj.ResourceType).Inc()
+	}
+}
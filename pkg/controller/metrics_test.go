@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/metrics"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// histogramCount 返回直方图的样本数
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := o.(prometheus.Histogram).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metrics.RegisterWorkqueueProvider()
+	c, err := NewController(1, nil, WithQueueName("metrics_test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		return errors.New("failed")
+	})
+
+	// 指标是全局的，比较前后的差值，-count 多次运行时同样成立
+	latency := metrics.QueueLatency.WithLabelValues("metrics", queue.Pods)
+	handlerErrors := metrics.HandlerErrors.WithLabelValues("metrics", queue.Pods)
+	requeues := metrics.Requeues.WithLabelValues("metrics", queue.Pods)
+	deadLetters := metrics.DeadLetters.WithLabelValues("metrics", queue.Pods)
+	latencyBefore := histogramCount(t, latency)
+	errorsBefore, requeuesBefore, deadBefore := testutil.ToFloat64(handlerErrors), testutil.ToFloat64(requeues), testutil.ToFloat64(deadLetters)
+
+	obj := queue.QueueObject{ClusterName: "metrics", ResourceType: queue.Pods, Event: queue.EventAdd, Key: "default/a", CreateAt: time.Now()}
+	c.Push(obj)
+	for i := 0; i < 2; i++ {
+		got, err := c.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.HandleObject(got); err == nil {
+			t.Fatal("expected handler error")
+		}
+		// 第一次重新入列，第二次超过最大次数被丢弃
+		_ = c.ReQueue(got)
+	}
+
+	if n := histogramCount(t, latency) - latencyBefore; n != 2 {
+		t.Errorf("queue latency observations: %d", n)
+	}
+	if n := testutil.ToFloat64(handlerErrors) - errorsBefore; n != 2 {
+		t.Errorf("handler errors: %v", n)
+	}
+	if n := testutil.ToFloat64(requeues) - requeuesBefore; n != 1 {
+		t.Errorf("requeues: %v", n)
+	}
+	if n := testutil.ToFloat64(deadLetters) - deadBefore; n != 1 {
+		t.Errorf("dead letters: %v", n)
+	}
+
+	rec := httptest.NewRecorder()
+	c.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`multi_cluster_informer_handler_errors_total{cluster="metrics",resource="pods"}`,
+		`multi_cluster_informer_workqueue_adds_total{name="metrics_test"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	// 未调用 RegisterRuntimeCollectors 时不包含 Go 运行时指标
+	if strings.Contains(string(body), "go_goroutines") {
+		t.Error("runtime collectors should be opt-in")
+	}
+}
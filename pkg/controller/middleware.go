@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/practice/multi_cluster_informer/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware 包装 HandleFunc 的中间件
+// 每个分发的 QueueObject 都会依次经过中间件链，再进入 handler 与 Reconciler
+type Middleware func(next HandleFunc) HandleFunc
+
+// Use 加入中间件，先加入的位于最外层
+func (c *Controller) Use(middlewares ...Middleware) {
+	c.handlerMu.Lock()
+	defer c.handlerMu.Unlock()
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+// chain 按加入顺序组装中间件链
+func chain(middlewares []Middleware, h HandleFunc) HandleFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Logging 记录每个对象的处理结果与耗时
+func Logging() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, obj queue.QueueObject) error {
+			start := time.Now()
+			err := next(ctx, obj)
+			// ctx 中的 logger 已带有 cluster、resource、key、event 字段
+			logger := LoggerFrom(ctx)
+			if err != nil {
+				logger.Error(err, "handle failed", "duration", time.Since(start))
+				return err
+			}
+			logger.V(4).Info("handle done", "duration", time.Since(start))
+			return nil
+		}
+	}
+}
+
+// Timing 处理结束后回调 observe，可用于自定义统计
+func Timing(observe func(obj queue.QueueObject, d time.Duration, err error)) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, obj queue.QueueObject) error {
+			start := time.Now()
+			err := next(ctx, obj)
+			observe(obj, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Recover 捕获 handler 中的 panic 并转换为错误，避免整个进程退出
+func Recover() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, obj queue.QueueObject) (err error) {
+			defer recoverPanic(ctx, &err)
+			return next(ctx, obj)
+		}
+	}
+}
+
+// recoverPanic 将 panic 记录日志并转换为错误，必须直接通过 defer 调用
+func recoverPanic(ctx context.Context, err *error) {
+	if r := recover(); r != nil {
+		LoggerFrom(ctx).Error(fmt.Errorf("%v", r), "handler panic", "stack", string(debug.Stack()))
+		*err = fmt.Errorf("handler panic: %v", r)
+	}
+}
+
+// Timeout 限制单次处理的时间，超时后 ctx 被取消并返回 context.DeadlineExceeded
+// handler 需要自行响应 ctx 的取消，否则只会在后台继续执行
+// handler 在单独的 goroutine 中执行，外层的 Recover 捕获不到其中的 panic，所以在这里转换为错误
+func Timeout(d time.Duration) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, obj queue.QueueObject) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			errC := make(chan error, 1)
+			go func() {
+				var err error
+				defer func() { errC <- err }()
+				defer recoverPanic(ctx, &err)
+				err = next(ctx, obj)
+			}()
+			select {
+			case err := <-errC:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Tracing 为每次处理创建 handle span，并与入队时的 ingest span 建立 link
+// 使用控制器的 TracerProvider，handler 可通过 tracing.TracerFrom(ctx) 创建子 span，放在最外层时 span 记录的是其他中间件处理后的错误
+func Tracing() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, obj queue.QueueObject) error {
+			opts := []trace.SpanStartOption{
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(tracing.Attributes(obj.ClusterName, obj.ResourceType, obj.Key, obj.Event)...),
+			}
+			if link := tracing.Extract(obj.TraceParent); link.IsValid() {
+				opts = append(opts, trace.WithLinks(trace.Link{SpanContext: link}))
+			}
+			ctx, span := tracing.TracerFrom(ctx).Start(ctx, "handle "+obj.ResourceType, opts...)
+			err := next(ctx, obj)
+			tracing.End(span, err)
+			return err
+		}
+	}
+}
+
+// ClassifyFunc 将 handler 返回的错误重新分类，
+// 例如返回 queue.Permanent(err) 表示不再重试，返回 queue.RetryAfter(d, err) 表示延迟重试
+type ClassifyFunc func(obj queue.QueueObject, err error) error
+
+// RetryClassifier 使用 classify 对非空错误重新分类
+func RetryClassifier(classify ClassifyFunc) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, obj queue.QueueObject) error {
+			if err := next(ctx, obj); err != nil {
+				return classify(obj, err)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx context.Context, obj queue.QueueObject) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, obj)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Use(record("a"), record("b"))
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	if err = c.HandleObject(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Key: "default/a"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "a before,b before,handler,b after,a after"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := chain([]Middleware{Recover()}, func(ctx context.Context, obj queue.QueueObject) error {
+		panic("boom")
+	})
+	if err := h(context.Background(), queue.QueueObject{}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected panic converted to error, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := chain([]Middleware{Timeout(20 * time.Millisecond)}, func(ctx context.Context, obj queue.QueueObject) error {
+		<-ctx.Done()
+		return nil
+	})
+	if err := h(context.Background(), queue.QueueObject{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	failed := errors.New("failed")
+	h = chain([]Middleware{Timeout(time.Second)}, func(ctx context.Context, obj queue.QueueObject) error {
+		return failed
+	})
+	if err := h(context.Background(), queue.QueueObject{}); !errors.Is(err, failed) {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+}
+
+func TestPanicUnderTimeout(t *testing.T) {
+	// 文档推荐的顺序：Recover 在外层，Timeout 在内层，panic 发生在 Timeout 的 goroutine 中
+	h := chain([]Middleware{Recover(), Timeout(time.Second)}, func(ctx context.Context, obj queue.QueueObject) error {
+		panic("boom")
+	})
+	if err := h(context.Background(), queue.QueueObject{}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected panic converted to error, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// Option 控制器可选配置
+type Option func(c *Controller)
+
+// Runnable 随控制器一起运行的后台任务，ctx 结束时应返回
+type Runnable func(ctx context.Context)
+
+// WithRunnable 加入随控制器一起运行的后台任务，在 Run 时启动
+func WithRunnable(r Runnable) Option {
+	return func(c *Controller) {
+		c.runnables = append(c.runnables, r)
+	}
+}
+
+// WithDrainTimeout 停止时最多等待 d 让正在处理的对象完成
+func WithDrainTimeout(d time.Duration) Option {
+	return func(c *Controller) {
+		c.DrainTimeout = d
+	}
+}
+
+// WithCacheSyncTimeout 每个集群最多等待 d 完成缓存同步，超时的集群以降级模式运行
+func WithCacheSyncTimeout(d time.Duration) Option {
+	return func(c *Controller) {
+		c.CacheSyncTimeout = d
+	}
+}
+
+// WithHealthCheck 对每个集群定期探测 /readyz
+func WithHealthCheck(hc HealthCheck) Option {
+	return func(c *Controller) {
+		c.HealthCheck = &hc
+	}
+}
+
+// WithQueueName 指定工作队列名，同一进程中有多个控制器时用于区分 workqueue 指标
+func WithQueueName(name string) Option {
+	return func(c *Controller) {
+		c.QueueName = name
+	}
+}
+
+// WithTracerProvider 使用 tp 创建 span，不依赖 otel 全局的 TracerProvider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Controller) {
+		c.TracerProvider = tp
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// Request 调和请求
+// 只描述"哪个集群的哪个资源对象发生了变化"，不区分 add/update/delete 事件
+type Request struct {
+	Cluster   string // 集群名称
+	Resource  string // 资源类型
+	Namespace string
+	Name      string
+}
+
+// Key 返回 <namespace>/<name>，集群级资源只返回 <name>
+func (r Request) Key() string {
+	if r.Namespace == "" {
+		return r.Name
+	}
+	return r.Namespace + "/" + r.Name
+}
+
+// Result 调和结果
+type Result struct {
+	// Requeue 是否按限速器退避重新入列
+	Requeue bool
+	// RequeueAfter 大于 0 时，在指定时间后重新入列
+	RequeueAfter time.Duration
+}
+
+// Reconciler 调和接口
+// 实现者应通过 queue.Store 的 GetByClusterKey 读取对象当前状态，
+// 而不是依赖 QueueObject.Obj；对象不存在时即表示已被删除
+// cluster-unhealthy / cluster-recovered 等集群事件没有对应的缓存对象，不会交给 Reconciler，需要通过 AddEventHandler 处理
+type Reconciler interface {
+	Reconcile(ctx context.Context, req Request) (Result, error)
+}
+
+// ReconcileFunc 函数形式的 Reconciler
+type ReconcileFunc func(ctx context.Context, req Request) (Result, error)
+
+func (f ReconcileFunc) Reconcile(ctx context.Context, req Request) (Result, error) {
+	return f(ctx, req)
+}
+
+// errRequeue Result.Requeue 为 true 时返回，调用方据此使用 ReQueue 重新入列
+var errRequeue = errors.New("reconciler requested requeue")
+
+// AddReconciler 加入调和器
+func (c *Controller) AddReconciler(r Reconciler) {
+	c.handlerMu.Lock()
+	defer c.handlerMu.Unlock()
+	c.Reconciler = r
+}
+
+// reconcileObject 返回对象的调和请求在队列中的形式
+// 只保留集群、资源与 key，不带事件时间与 TraceParent，同一对象尚未取出的多个调和请求在队列中合并为一个
+func reconcileObject(qo queue.QueueObject) queue.QueueObject {
+	return queue.QueueObject{
+		ClusterName:   qo.ClusterName,
+		ClusterLabels: qo.ClusterLabels,
+		Event:         queue.EventReconcile,
+		ResourceType:  qo.ResourceType,
+		Key:           qo.Key,
+	}
+}
+
+// reconcile 将调和请求转换为 Request 并调用调和器
+func (c *Controller) reconcile(ctx context.Context, reconciler Reconciler, obj queue.QueueObject) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(obj.Key)
+	if err != nil {
+		return err
+	}
+	req := Request{Cluster: obj.ClusterName, Resource: obj.ResourceType, Namespace: namespace, Name: name}
+	res, err := reconciler.Reconcile(ctx, req)
+	switch {
+	case err != nil:
+		return err
+	case res.RequeueAfter > 0:
+		return queue.RetryAfter(res.RequeueAfter, nil)
+	case res.Requeue:
+		return errRequeue
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"testing"
+)
+
+func TestReconcileDedup(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []Request
+	c.AddReconciler(ReconcileFunc(func(ctx context.Context, req Request) (Result, error) {
+		reqs = append(reqs, req)
+		return Result{}, nil
+	}))
+
+	// 同一对象的多个事件只产生一个调和请求
+	handle := initHandle(queue.Pods, c, "cluster1", ResourceAndNamespace{}, c.ingest)
+	old := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", ResourceVersion: "1"}}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", ResourceVersion: "2"}}
+	handle.OnAdd(old)
+	handle.OnUpdate(old, pod)
+	handle.OnDelete(pod)
+	if n := c.Queue.(*queue.Wq).Len(); n != 1 {
+		t.Fatalf("expected 1 queued request, got %d", n)
+	}
+
+	obj, _ := c.Pop()
+	if obj.Event != queue.EventReconcile {
+		t.Fatalf("expected reconcile request, got %v", obj.Event)
+	}
+	if err = c.HandleObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	c.Finish(obj)
+	want := Request{Cluster: "cluster1", Resource: queue.Pods, Namespace: "default", Name: "a"}
+	if len(reqs) != 1 || reqs[0] != want {
+		t.Fatalf("expected %v, got %v", want, reqs)
+	}
+}
+
+func TestReconcileReadsStore(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}, Status: v1.PodStatus{Phase: v1.PodRunning}})
+	c.indexers.Set("cluster1", queue.MapIndexers{queue.Pods: {indexer}})
+
+	phases := map[string]v1.PodPhase{}
+	c.AddReconciler(ReconcileFunc(func(ctx context.Context, req Request) (Result, error) {
+		item, exists := c.GetByClusterKey(req.Cluster, req.Resource, req.Key())
+		if !exists {
+			phases[req.Key()] = "deleted"
+			return Result{}, nil
+		}
+		phases[req.Key()] = item.(*v1.Pod).Status.Phase
+		return Result{}, nil
+	}))
+
+	for _, key := range []string{"default/a", "default/b"} {
+		c.Push(reconcileObject(queue.QueueObject{ClusterName: "cluster1", ResourceType: queue.Pods, Key: key}))
+		obj, _ := c.Pop()
+		if err = c.HandleObject(obj); err != nil {
+			t.Fatal(err)
+		}
+		c.Finish(obj)
+	}
+	if phases["default/a"] != v1.PodRunning || phases["default/b"] != "deleted" {
+		t.Fatalf("unexpected phases: %v", phases)
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+)
+
+// HTTPServer 内置的 HTTP 服务，提供健康检查、就绪检查、指标与调试接口
+type HTTPServer struct {
+	// Addr 监听地址，如 :8080
+	Addr string `json:"addr" yaml:"addr"`
+	// Pprof 是否开启 /debug/pprof/
+	Pprof bool `json:"pprof" yaml:"pprof"`
+	// ShutdownTimeout 停止时等待请求完成的时间，默认 5s
+	ShutdownTimeout time.Duration `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+}
+
+// WithHTTPServer 随控制器一起启动 HTTP 服务
+func WithHTTPServer(s HTTPServer) Option {
+	return func(c *Controller) {
+		c.HTTPServer = &s
+	}
+}
+
+// HTTPHandler 返回内置 HTTP 服务的 handler，可挂载到调用方自己的服务上
+//
+//	/healthz         控制器未停止时返回 200
+//	/readyz          所有需要的informer都已同步、且至少有一个已同步的集群时返回 200，否则返回 503 及原因
+//	/metrics         Prometheus 指标
+//	/debug/clusters  每个集群、每个informer的状态，JSON 格式
+//	/debug/pprof/    开启 pprof 时提供
+func (c *Controller) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-c.StopC:
+			http.Error(w, "controller stopped", http.StatusServiceUnavailable)
+		default:
+			_, _ = fmt.Fprintln(w, "ok")
+		}
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if reason := c.notReady(); reason != "" {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/metrics", c.MetricsHandler())
+	mux.HandleFunc("/debug/clusters", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(c.Status())
+	})
+	if c.HTTPServer != nil && c.HTTPServer.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// notReady 返回未就绪的原因，就绪时返回空
+// 开启分片时不属于当前副本的集群、因不健康而暂停的集群、启动时同步超时以降级模式运行的集群不需要同步，
+// 但至少需要一个当前副本负责且已同步的集群，所有集群都降级或尚未分配到集群时不算就绪
+func (c *Controller) notReady() string {
+	var pending []string
+	synced := 0
+	for _, cs := range c.Status() {
+		if !cs.Owned || cs.Paused || cs.SyncError != "" {
+			continue
+		}
+		if !cs.Synced {
+			pending = append(pending, cs.Name)
+			continue
+		}
+		synced++
+	}
+	switch {
+	case len(pending) > 0:
+		return "informers not synced: " + strings.Join(pending, ",")
+	case synced == 0:
+		return "no synced cluster"
+	}
+	return ""
+}
+
+// startHTTPServer 监听端口并在后台提供服务，ctx 结束时停止，返回的 chan 在服务停止后关闭
+// 监听失败时直接返回错误，避免端口被占用时静默运行
+func (c *Controller) startHTTPServer(ctx context.Context) (<-chan struct{}, error) {
+	s := c.HTTPServer
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: c.HTTPHandler(), ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Logger.Info("http server listening", "addr", ln.Addr().String())
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			c.Logger.Error(err, "http server stopped")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		timeout := s.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	return done, nil
+}
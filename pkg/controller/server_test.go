@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// syncedInformer 只实现 HasSynced 的informer
+type syncedInformer struct {
+	cache.Controller
+	synced bool
+}
+
+func (s syncedInformer) HasSynced() bool {
+	return s.synced
+}
+
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+func TestHTTPHandler(t *testing.T) {
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.clusters["cluster1"] = &clusterEntry{name: "cluster1", informers: InformerList{syncedInformer{synced: false}}, health: clusterHealth{Healthy: true}}
+	c.clusters["cluster2"] = &clusterEntry{name: "cluster2", informers: InformerList{syncedInformer{synced: true}}, health: clusterHealth{Healthy: true}}
+	h := c.HTTPHandler()
+
+	if rec := get(h, "/healthz"); rec.Code != http.StatusOK {
+		t.Fatalf("healthz: %d", rec.Code)
+	}
+	if rec := get(h, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz before sync: %d", rec.Code)
+	}
+	// 暂停的集群不影响就绪
+	c.clusters["cluster1"].health.Paused = true
+	if rec := get(h, "/readyz"); rec.Code != http.StatusOK {
+		t.Fatalf("readyz with paused cluster: %d %s", rec.Code, rec.Body)
+	}
+	// 同步超时、以降级模式运行的集群不影响就绪
+	c.clusters["cluster1"].health.Paused = false
+	c.failedClusters["cluster1"] = ErrCacheSync
+	if rec := get(h, "/readyz"); rec.Code != http.StatusOK {
+		t.Fatalf("readyz with degraded cluster: %d %s", rec.Code, rec.Body)
+	}
+	// 所有集群都降级时未就绪
+	c.failedClusters["cluster2"] = ErrCacheSync
+	if rec := get(h, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz with all clusters degraded: %d %s", rec.Code, rec.Body)
+	}
+	delete(c.failedClusters, "cluster2")
+
+	rec := get(h, "/debug/clusters")
+	var status []ClusterStatus
+	if err = json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || status[0].Name != "cluster1" || status[0].Synced {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if rec = get(h, "/metrics"); rec.Code != http.StatusOK {
+		t.Fatalf("metrics: %d", rec.Code)
+	}
+	if rec = get(h, "/debug/pprof/"); rec.Code != http.StatusNotFound {
+		t.Fatalf("pprof should be disabled by default: %d", rec.Code)
+	}
+
+	c.HTTPServer = &HTTPServer{Pprof: true}
+	if rec = get(c.HTTPHandler(), "/debug/pprof/"); rec.Code != http.StatusOK {
+		t.Fatalf("pprof: %d", rec.Code)
+	}
+	c.Stop()
+	if rec = get(h, "/healthz"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("healthz after stop: %d", rec.Code)
+	}
+}
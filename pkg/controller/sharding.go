@@ -0,0 +1,303 @@
+package controller
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ShardGroupLabel 分片成员 Lease 的标签，值为分片组名
+const ShardGroupLabel = "multi-cluster-informer/shard-group"
+
+// Sharding 多副本分片：按集群名一致性哈希，每个副本只启动自己负责的集群的informer
+// 副本通过 home 集群中的 Lease 登记，副本加入或退出时重新分配集群
+// 重新分配期间可能短暂出现某个集群同时被两个副本处理或暂时无人处理
+type Sharding struct {
+	// HomeCluster 成员 Lease 所在的集群名，必须是已配置的集群
+	HomeCluster string `json:"homeCluster" yaml:"homeCluster"`
+	// Namespace Lease 所在的 namespace，默认 default
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Name 分片组名，同组的副本分担所有集群，默认 multi-cluster-informer
+	Name string `json:"name" yaml:"name"`
+	// Identity 当前副本的标识，默认 hostname_随机串
+	Identity string `json:"identity" yaml:"identity"`
+	// LeaseDuration 成员超过该时间未续约视为退出，默认 15s
+	LeaseDuration time.Duration `json:"leaseDuration" yaml:"leaseDuration"`
+	// RenewInterval 续约并检查成员变化的间隔，默认 5s
+	RenewInterval time.Duration `json:"renewInterval" yaml:"renewInterval"`
+	// VirtualNodes 每个副本在哈希环上的虚拟节点数，越大分配越均匀，默认 100
+	VirtualNodes int `json:"virtualNodes" yaml:"virtualNodes"`
+
+	// Client 创建 Lease 使用的客户端，为空时使用 HomeCluster 的客户端，测试时可传入 fake clientset
+	Client kubernetes.Interface `json:"-" yaml:"-"`
+}
+
+// WithDefaults 返回填充默认值后的配置
+func (s Sharding) WithDefaults() Sharding {
+	if s.Namespace == "" {
+		s.Namespace = "default"
+	}
+	if s.Name == "" {
+		s.Name = "multi-cluster-informer"
+	}
+	if s.Identity == "" {
+		hostname, _ := os.Hostname()
+		s.Identity = hostname + "_" + string(uuid.NewUUID())
+	}
+	if s.LeaseDuration <= 0 {
+		s.LeaseDuration = 15 * time.Second
+	}
+	if s.RenewInterval <= 0 {
+		s.RenewInterval = 5 * time.Second
+	}
+	if s.VirtualNodes <= 0 {
+		s.VirtualNodes = 100
+	}
+	return s
+}
+
+// WithSharding 开启分片，每个副本只启动自己负责的集群
+func WithSharding(s Sharding) Option {
+	return func(c *Controller) {
+		s = s.WithDefaults()
+		c.Sharding = &s
+	}
+}
+
+// hashRing 一致性哈希环
+type hashRing struct {
+	members []string
+	hashes  []uint32
+	owners  map[uint32]string
+}
+
+func newHashRing(members []string, virtualNodes int) *hashRing {
+	r := &hashRing{members: members, owners: make(map[uint32]string, len(members)*virtualNodes)}
+	for _, m := range members {
+		for i := 0; i < virtualNodes; i++ {
+			h := hashKey(m + "#" + strconv.Itoa(i))
+			r.hashes = append(r.hashes, h)
+			r.owners[h] = m
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// owner 返回负责 key 的成员，没有成员时返回空
+func (r *hashRing) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// hashKey 虚拟节点名相近，fnv 等简单哈希分布不均，这里取 md5 的前 4 字节
+func hashKey(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// ownsCluster 当前副本是否负责该集群，未开启分片时总是 true
+func (c *Controller) ownsCluster(name string) bool {
+	if c.Sharding == nil {
+		return true
+	}
+	return c.clusterOwner(name) == c.Sharding.Identity
+}
+
+// clusterOwner 返回负责该集群的副本，尚未获取成员时返回空
+func (c *Controller) clusterOwner(name string) string {
+	c.shardMu.RLock()
+	defer c.shardMu.RUnlock()
+	if c.ring == nil {
+		return ""
+	}
+	return c.ring.owner(name)
+}
+
+// ShardMembers 返回当前存活的分片成员，未开启分片时返回空
+func (c *Controller) ShardMembers() []string {
+	c.shardMu.RLock()
+	defer c.shardMu.RUnlock()
+	if c.ring == nil {
+		return nil
+	}
+	return append([]string(nil), c.ring.members...)
+}
+
+// shardClient 返回创建成员 Lease 使用的客户端
+func (c *Controller) shardClient() (kubernetes.Interface, error) {
+	s := c.Sharding
+	if s.Client != nil {
+		return s.Client, nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.clusters[s.HomeCluster]
+	if !ok {
+		return nil, fmt.Errorf("sharding home cluster [%v] not found", s.HomeCluster)
+	}
+	return e.client, nil
+}
+
+// leaseName 成员 Lease 的名称，identity 可能包含 Lease 名称中不允许的字符，所以使用哈希
+func (s *Sharding) leaseName() string {
+	return fmt.Sprintf("%s-%08x", s.Name, hashKey(s.Identity))
+}
+
+// syncShards 续约自己的 Lease，并根据存活的成员更新哈希环，返回成员是否变化
+func (c *Controller) syncShards(ctx context.Context, client kubernetes.Interface) (bool, error) {
+	s := c.Sharding
+	leases := client.CoordinationV1().Leases(s.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(s.LeaseDuration / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	lease, err := leases.Get(ctx, s.leaseName(), metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: s.leaseName(), Namespace: s.Namespace, Labels: map[string]string{ShardGroupLabel: s.Name}},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.Identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err = leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			return false, err
+		}
+	case err != nil:
+		return false, err
+	default:
+		lease.Spec.HolderIdentity = &s.Identity
+		lease.Spec.LeaseDurationSeconds = &seconds
+		lease.Spec.RenewTime = &now
+		if _, err = leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			return false, err
+		}
+	}
+
+	list, err := leases.List(ctx, metav1.ListOptions{LabelSelector: labels.Set{ShardGroupLabel: s.Name}.String()})
+	if err != nil {
+		return false, err
+	}
+	members := make([]string, 0, len(list.Items))
+	for _, l := range list.Items {
+		if l.Spec.HolderIdentity == nil || l.Spec.RenewTime == nil || l.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expire := l.Spec.RenewTime.Add(time.Duration(*l.Spec.LeaseDurationSeconds) * time.Second)
+		if *l.Spec.HolderIdentity == s.Identity || now.Time.Before(expire) {
+			members = append(members, *l.Spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+
+	c.shardMu.Lock()
+	defer c.shardMu.Unlock()
+	if c.ring != nil && reflect.DeepEqual(c.ring.members, members) {
+		return false, nil
+	}
+	c.Logger.Info("shard members changed", "members", members)
+	c.ring = newHashRing(members, s.VirtualNodes)
+	return true, nil
+}
+
+// initShards 启动时登记成员并建立哈希环
+// 失败时先按只有自己建立，由当前副本负责所有集群，避免集群无人处理，之后续约成功时重新分配
+func (c *Controller) initShards(ctx context.Context, client kubernetes.Interface) {
+	_, err := c.syncShards(ctx, client)
+	if err == nil {
+		return
+	}
+	c.Logger.Error(err, "sync shard members failed, own all clusters until the next sync")
+	c.shardMu.Lock()
+	defer c.shardMu.Unlock()
+	if c.ring == nil {
+		c.ring = newHashRing([]string{c.Sharding.Identity}, c.Sharding.VirtualNodes)
+	}
+}
+
+// runSharding 定期续约并在成员变化时重新分配集群，ctx 结束时删除自己的 Lease，其他副本可以立即接管
+func (c *Controller) runSharding(ctx context.Context, client kubernetes.Interface) {
+	s := c.Sharding
+	ticker := time.NewTicker(s.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), s.RenewInterval)
+			defer cancel()
+			err := client.CoordinationV1().Leases(s.Namespace).Delete(releaseCtx, s.leaseName(), metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				c.Logger.Error(err, "release shard lease failed")
+			}
+			return
+		case <-ticker.C:
+		}
+		changed, err := c.syncShards(ctx, client)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.Logger.Error(err, "sync shard members failed")
+			}
+			continue
+		}
+		if changed {
+			c.rebalance(ctx)
+		}
+	}
+}
+
+// rebalance 启动新分配给自己的集群，停止不再负责的集群
+func (c *Controller) rebalance(ctx context.Context) {
+	var acquired, released int
+	for _, e := range c.clusterList() {
+		owns := c.ownsCluster(e.name)
+		running := e.isOwned()
+		switch {
+		case owns && !running:
+			acquired++
+			c.startClusterAsync(ctx, e)
+		case !owns && running:
+			released++
+			c.releaseCluster(e)
+		}
+	}
+	c.Logger.Info("sharding rebalanced", "acquired", acquired, "released", released)
+}
+
+// releaseCluster 停止不再负责的集群，并重建空的informer与缓存，之后可以重新启动
+// 其他副本会接管该集群，所以不放入 delete 事件
+func (c *Controller) releaseCluster(e *clusterEntry) {
+	e.shutdown()
+	e.mu.Lock()
+	e.owned = false
+	e.health = clusterHealth{Healthy: true}
+	e.mu.Unlock()
+	c.indexers.Set(e.name, e.build(c.Queue, c.ingest, c.CacheSyncTimeout))
+	c.mu.Lock()
+	delete(c.failedClusters, e.name)
+	c.mu.Unlock()
+}
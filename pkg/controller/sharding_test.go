@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHashRing(t *testing.T) {
+	names := make([]string, 0, 300)
+	for i := 0; i < 300; i++ {
+		names = append(names, fmt.Sprintf("cluster-%d", i))
+	}
+
+	two := newHashRing([]string{"a", "b"}, 100)
+	three := newHashRing([]string{"a", "b", "c"}, 100)
+	count := map[string]int{}
+	moved := 0
+	for _, name := range names {
+		before, after := two.owner(name), three.owner(name)
+		count[after]++
+		// 新成员加入时，只有分配给新成员的集群会移动
+		if before != after {
+			moved++
+			if after != "c" {
+				t.Fatalf("%v moved from %v to %v", name, before, after)
+			}
+		}
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		if count[m] < 50 {
+			t.Fatalf("uneven distribution: %v", count)
+		}
+	}
+	if moved != count["c"] {
+		t.Fatalf("moved %d, want %d", moved, count["c"])
+	}
+	if owner := newHashRing(nil, 100).owner("x"); owner != "" {
+		t.Fatalf("empty ring owner = %q", owner)
+	}
+}
+
+func newTestShard(t *testing.T, client *fake.Clientset, identity string) *Controller {
+	t.Helper()
+	c, err := NewController(1, nil, WithSharding(Sharding{
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewInterval: 100 * time.Millisecond,
+		Client:        client,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestShardMembers(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	a := newTestShard(t, client, "a")
+	b := newTestShard(t, client, "b")
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	go func() { _ = a.Run(ctxA) }()
+	waitFor(t, func() bool { return reflect.DeepEqual(a.ShardMembers(), []string{"a"}) }, "a should join")
+	if !a.ownsCluster("cluster1") {
+		t.Fatal("single member owns all clusters")
+	}
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	doneB := make(chan error)
+	go func() { doneB <- b.Run(ctxB) }()
+	both := func(c *Controller) func() bool {
+		return func() bool { return reflect.DeepEqual(c.ShardMembers(), []string{"a", "b"}) }
+	}
+	waitFor(t, both(a), "a should see b")
+	waitFor(t, both(b), "b should see a")
+	if a.clusterOwner("cluster1") != b.clusterOwner("cluster1") {
+		t.Fatal("replicas disagree on owner")
+	}
+
+	// b 退出时删除 Lease，a 重新负责所有集群
+	cancelB()
+	if err := <-doneB; err != nil {
+		t.Fatalf("unexpected error on normal stop: %v", err)
+	}
+	waitFor(t, func() bool { return reflect.DeepEqual(a.ShardMembers(), []string{"a"}) }, "a should see b leave")
+
+	c, _ := NewController(1, nil)
+	if !c.ownsCluster("cluster1") || c.ShardMembers() != nil {
+		t.Fatal("controller without sharding owns all clusters")
+	}
+}
+
+func TestShardInitialSyncFailure(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	failed := false
+	client.PrependReactor("get", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !failed {
+			failed = true
+			return true, nil, errors.New("home cluster unavailable")
+		}
+		return false, nil, nil
+	})
+	c := newTestShard(t, client, "a")
+
+	// 第一次登记失败时由自己负责所有集群
+	c.initShards(context.Background(), client)
+	if !reflect.DeepEqual(c.ShardMembers(), []string{"a"}) || !c.ownsCluster("cluster1") {
+		t.Fatalf("should own all clusters after failed sync, members %v", c.ShardMembers())
+	}
+	// 之后续约成功，成员不变
+	if changed, err := c.syncShards(context.Background(), client); err != nil || changed {
+		t.Fatalf("unexpected sync result: %v %v", changed, err)
+	}
+}
+
+func TestRebalanceMarksOwned(t *testing.T) {
+	c := newTestShard(t, fake.NewSimpleClientset(), "a")
+	c.ring = newHashRing([]string{"a"}, c.Sharding.VirtualNodes)
+	e := &clusterEntry{name: "cluster1", informers: InformerList{fakeInformer{}}, logger: c.Logger, health: clusterHealth{Healthy: true}}
+	c.clusters[e.name] = e
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// rebalance 返回时已标记为已启动，紧接着的 rebalance 不会重复启动
+	c.rebalance(ctx)
+	if !e.isOwned() {
+		t.Fatal("cluster should be marked owned before the start goroutine runs")
+	}
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
+)
+
+// InformerStatus 单个informer的状态
+type InformerStatus struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace"`
+	// Synced 是否完成首次缓存同步
+	Synced bool `json:"synced"`
+	// LastListTime 最近一次 list 成功的时间
+	LastListTime time.Time `json:"lastListTime"`
+	// LastWatchError 最近一次 list/watch 错误，包括 watch 流中的错误事件，成功后不会清空
+	LastWatchError string `json:"lastWatchError,omitempty"`
+	// LastWatchErrorTime 最近一次 list/watch 错误的时间
+	LastWatchErrorTime time.Time `json:"lastWatchErrorTime,omitempty"`
+	// WatchRestarts watch 重新建立的次数，不含第一次
+	WatchRestarts int `json:"watchRestarts"`
+	// ObjectCount 本地缓存中的对象数
+	ObjectCount int `json:"objectCount"`
+}
+
+// ClusterStatus 单个集群的状态
+type ClusterStatus struct {
+	Name string `json:"name"`
+	// Synced 该集群所有informer是否都已同步
+	Synced bool `json:"synced"`
+	// SyncError 启动时等待缓存同步失败的原因
+	SyncError string `json:"syncError,omitempty"`
+	// Healthy 健康检查结果，未开启健康检查时始终为 true
+	Healthy bool `json:"healthy"`
+	// Paused 是否因不健康而暂停了informer
+	Paused bool `json:"paused"`
+	// ConsecutiveFailures 健康检查连续失败次数
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// LastProbeError 最近一次健康检查的错误
+	LastProbeError string `json:"lastProbeError,omitempty"`
+	// Owner 开启分片时负责该集群的副本
+	Owner string `json:"owner,omitempty"`
+	// Owned 开启分片时该集群是否在当前副本运行，未开启分片时始终为 true
+	Owned     bool             `json:"owned"`
+	Informers []InformerStatus `json:"informers"`
+}
+
+// HasSynced 所有集群的informer是否都已同步，开启分片时只看当前副本负责的集群
+func (c *Controller) HasSynced() bool {
+	for _, e := range c.clusterList() {
+		if c.Sharding != nil && !c.ownsCluster(e.name) {
+			continue
+		}
+		for _, one := range e.informerList() {
+			if !one.HasSynced() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Status 返回每个集群、每个informer的状态，按集群名排序
+func (c *Controller) Status() []ClusterStatus {
+	failed := c.FailedClusters()
+	clusters := c.clusterList()
+	res := make([]ClusterStatus, 0, len(clusters))
+	for _, e := range clusters {
+		informers := e.informerList()
+		cs := ClusterStatus{Name: e.name, Synced: true, Informers: make([]InformerStatus, 0, len(informers))}
+		if err, ok := failed[e.name]; ok {
+			cs.SyncError = err.Error()
+		}
+		e.mu.Lock()
+		cs.Healthy = e.health.Healthy
+		cs.Paused = e.health.Paused
+		cs.ConsecutiveFailures = e.health.ConsecutiveFailures
+		cs.Owned = c.Sharding == nil || e.owned
+		if e.health.LastProbeError != nil {
+			cs.LastProbeError = e.health.LastProbeError.Error()
+		}
+		e.mu.Unlock()
+		if c.Sharding != nil {
+			cs.Owner = c.clusterOwner(e.name)
+		}
+		for _, one := range informers {
+			var is InformerStatus
+			if t, ok := one.(*trackedInformer); ok {
+				is = t.status()
+			} else {
+				is = InformerStatus{Synced: one.HasSynced()}
+			}
+			cs.Synced = cs.Synced && is.Synced
+			cs.Informers = append(cs.Informers, is)
+		}
+		res = append(res, cs)
+	}
+	return res
+}
+
+// informerStats list/watch 统计信息
+type informerStats struct {
+	mu                 sync.Mutex
+	lastListTime       time.Time
+	lastWatchError     error
+	lastWatchErrorTime time.Time
+	watches            int
+}
+
+func (s *informerStats) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastWatchError = err
+	s.lastWatchErrorTime = time.Now()
+}
+
+// newTrackedListWatch 包装 ListWatch，记录 list 成功时间、watch 次数与错误，watch 流中的错误事件同样记录
+func newTrackedListWatch(c cache.Getter, resource string, namespace string) (*cache.ListWatch, *informerStats) {
+	lw := cache.NewListWatchFromClient(c, resource, namespace, fields.Everything())
+	stats := &informerStats{}
+	listFunc, watchFunc := lw.ListFunc, lw.WatchFunc
+	lw.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+		obj, err := listFunc(options)
+		if err != nil {
+			stats.recordError(err)
+			return nil, err
+		}
+		stats.mu.Lock()
+		stats.lastListTime = time.Now()
+		stats.mu.Unlock()
+		return obj, nil
+	}
+	lw.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+		w, err := watchFunc(options)
+		if err != nil {
+			stats.recordError(err)
+			return nil, err
+		}
+		stats.mu.Lock()
+		stats.watches++
+		stats.mu.Unlock()
+		return newTrackedWatch(w, stats), nil
+	}
+	return lw, stats
+}
+
+// trackedWatch 包装 watch.Interface，记录 watch 流中的错误事件，如 410 Gone、resourceVersion 过期与解码失败
+// 这些错误不经过 WatchFunc 的返回值，client-go v0.26 的 reflector 也只打印日志，不交给 WatchErrorHandler
+type trackedWatch struct {
+	watch.Interface
+	result   chan watch.Event
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newTrackedWatch(w watch.Interface, stats *informerStats) *trackedWatch {
+	t := &trackedWatch{Interface: w, result: make(chan watch.Event), done: make(chan struct{})}
+	go func() {
+		defer close(t.result)
+		for event := range w.ResultChan() {
+			if event.Type == watch.Error {
+				stats.recordError(apierrors.FromObject(event.Object))
+			}
+			select {
+			case t.result <- event:
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+func (t *trackedWatch) ResultChan() <-chan watch.Event {
+	return t.result
+}
+
+// Stop 停止底层的 watch，调用方不再读取时转发的 goroutine 随之退出
+func (t *trackedWatch) Stop() {
+	t.stopOnce.Do(func() { close(t.done) })
+	t.Interface.Stop()
+}
+
+// trackedInformer 带统计信息的informer
+type trackedInformer struct {
+	cache.Controller
+	indexer   cache.Indexer
+	stats     *informerStats
+	resource  string
+	namespace string
+}
+
+func (t *trackedInformer) status() InformerStatus {
+	t.stats.mu.Lock()
+	defer t.stats.mu.Unlock()
+	is := InformerStatus{
+		Resource:           t.resource,
+		Namespace:          t.namespace,
+		Synced:             t.HasSynced(),
+		LastListTime:       t.stats.lastListTime,
+		LastWatchErrorTime: t.stats.lastWatchErrorTime,
+		ObjectCount:        len(t.indexer.ListKeys()),
+	}
+	if t.stats.watches > 1 {
+		is.WatchRestarts = t.stats.watches - 1
+	}
+	if t.stats.lastWatchError != nil {
+		is.LastWatchError = t.stats.lastWatchError.Error()
+	}
+	return is
+}
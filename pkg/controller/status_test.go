@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusSnapshot(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	cluster := Cluster{MetaData: MetaData{ClusterName: "cluster1", Auth: Auth{Server: srv.URL}}}
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// list/watch 失败时记录最近的错误
+	lw, stats := newTrackedListWatch(client.CoreV1().RESTClient(), "pods", "default")
+	if _, err = lw.List(metav1.ListOptions{}); err == nil {
+		t.Fatal("expected list error")
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}})
+	informer := &trackedInformer{Controller: syncedInformer{synced: true}, indexer: indexer, stats: stats, resource: queue.Pods, namespace: "default"}
+
+	c, err := NewController(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.clusters["cluster1"] = &clusterEntry{name: "cluster1", informers: InformerList{informer}, health: clusterHealth{Healthy: true}}
+	c.clusters["cluster2"] = &clusterEntry{name: "cluster2", informers: InformerList{syncedInformer{}}, health: clusterHealth{Paused: true, ConsecutiveFailures: 3, LastProbeError: errors.New("probe failed")}}
+	c.failedClusters["cluster2"] = ErrCacheSync
+
+	status := c.Status()
+	if len(status) != 2 || status[0].Name != "cluster1" || status[1].Name != "cluster2" {
+		t.Fatalf("status should be sorted by cluster name: %+v", status)
+	}
+	got := status[0]
+	if !got.Synced || !got.Healthy || !got.Owned || got.SyncError != "" || len(got.Informers) != 1 {
+		t.Fatalf("unexpected cluster1 status: %+v", got)
+	}
+	is := got.Informers[0]
+	if is.Resource != queue.Pods || is.Namespace != "default" || is.ObjectCount != 1 || is.LastWatchError == "" || is.LastWatchErrorTime.IsZero() {
+		t.Fatalf("unexpected informer status: %+v", is)
+	}
+	got = status[1]
+	if got.Synced || got.Healthy || !got.Paused || got.ConsecutiveFailures != 3 || got.LastProbeError != "probe failed" || got.SyncError != ErrCacheSync.Error() {
+		t.Fatalf("unexpected cluster2 status: %+v", got)
+	}
+}
+
+func TestWatchStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// watch 建立成功，之后在流中返回 410 Gone
+		_, _ = w.Write([]byte(`{"type":"ERROR","object":{"kind":"Status","apiVersion":"v1","status":"Failure","message":"too old resource version","reason":"Expired","code":410}}`))
+	}))
+	defer srv.Close()
+	cluster := Cluster{MetaData: MetaData{ClusterName: "cluster1", Auth: Auth{Server: srv.URL}}}
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lw, stats := newTrackedListWatch(client.CoreV1().RESTClient(), "pods", "default")
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	select {
+	case event := <-w.ResultChan():
+		if event.Type != watch.Error {
+			t.Fatalf("expected error event, got %v", event.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch event")
+	}
+	informer := &trackedInformer{Controller: syncedInformer{synced: true}, indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}), stats: stats}
+	if is := informer.status(); !strings.Contains(is.LastWatchError, "too old resource version") || is.LastWatchErrorTime.IsZero() {
+		t.Fatalf("watch stream error should be recorded: %+v", is)
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"github.com/practice/multi_cluster_informer/pkg/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"regexp"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}
+	c, err := NewController(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未设置 TracerProvider 时使用全局的 no-op 实现，不记录 traceparent
+	initHandle(queue.Pods, c, "cluster1", ResourceAndNamespace{}, c.ingest).OnAdd(pod)
+	obj, _ := c.Pop()
+	if obj.TraceParent != "" {
+		t.Fatalf("expected no traceparent without tracer provider, got %q", obj.TraceParent)
+	}
+	c.Finish(obj)
+
+	// 通过选项注入 TracerProvider，不修改 otel 全局
+	recorder := tracetest.NewSpanRecorder()
+	c, err = NewController(2, nil, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Use(Tracing())
+	c.AddEventFilter(predicate.Not(predicate.NamespaceMatches(regexp.MustCompile(`^kube-`))))
+	var handlerSpan bool
+	c.AddEventHandler(func(ctx context.Context, object queue.QueueObject) error {
+		_, span := tracing.TracerFrom(ctx).Start(ctx, "child")
+		defer span.End()
+		handlerSpan = span.SpanContext().IsValid()
+		return nil
+	})
+	handle := initHandle(queue.Pods, c, "cluster1", ResourceAndNamespace{}, c.ingest)
+	// 被过滤的事件不创建 span
+	handle.OnAdd(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "a"}})
+	if n := len(recorder.Ended()); n != 0 {
+		t.Fatalf("filtered event should not create spans, got %d", n)
+	}
+	handle.OnAdd(pod)
+	obj, _ = c.Pop()
+	if err = c.HandleObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	c.Finish(obj)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 || !handlerSpan {
+		t.Fatalf("expected ingest, handle and child spans, got %d", len(spans))
+	}
+	ingest, child, handleSpan := spans[0], spans[1], spans[2]
+	if ingest.Name() != "ingest pods" || handleSpan.Name() != "handle pods" {
+		t.Fatalf("unexpected span names: %v %v", ingest.Name(), handleSpan.Name())
+	}
+	if len(handleSpan.Links()) != 1 || handleSpan.Links()[0].SpanContext.SpanID() != ingest.SpanContext().SpanID() {
+		t.Fatal("handle span should link to ingest span")
+	}
+	if child.Parent().SpanID() != handleSpan.SpanContext().SpanID() {
+		t.Fatal("handler span should be a child of the handle span")
+	}
+	attrs := map[string]string{}
+	for _, kv := range handleSpan.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs[string(tracing.ClusterKey)] != "cluster1" || attrs[string(tracing.KeyKey)] != "default/a" || attrs[string(tracing.EventKey)] != queue.EventAdd {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/practice/multi_cluster_informer/pkg/predicate"
+	"github.com/practice/multi_cluster_informer/pkg/queue"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"strings"
+)
+
+// UpdateFilter update 事件抑制配置，在入队前丢弃无意义的更新
+type UpdateFilter struct {
+	// GenerationChanged 为 true 时，只有 metadata.generation 变化的更新才入队，与 predicate.GenerationChanged 相同
+	// 没有 generation 的资源（如 pods configmaps）退化为比较 metadata.resourceVersion
+	GenerationChanged bool `json:"generationChanged" yaml:"generationChanged"`
+	// IgnorePaths 只有这些路径不同的更新会被丢弃，如 status、metadata.managedFields
+	// metadata.resourceVersion 总是被忽略
+	IgnorePaths []string `json:"ignorePaths" yaml:"ignorePaths"`
+}
+
+// suppress 判断该 update 事件是否需要丢弃
+func (f *UpdateFilter) suppress(logger logr.Logger, old, new interface{}) bool {
+	if f == nil {
+		return false
+	}
+	oldMeta, err1 := meta.Accessor(old)
+	newMeta, err2 := meta.Accessor(new)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	// resync 时新旧对象完全相同
+	if oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		return true
+	}
+	if f.GenerationChanged && !predicate.GenerationChanged()(predicate.Event{EventType: queue.EventUpdate, Object: new, OldObject: old}) {
+		return true
+	}
+	if len(f.IgnorePaths) > 0 {
+		return f.equalIgnoringPaths(logger, old, new)
+	}
+	return false
+}
+
+// equalIgnoringPaths 去掉忽略的路径后比较新旧对象
+func (f *UpdateFilter) equalIgnoringPaths(logger logr.Logger, old, new interface{}) bool {
+	oldU, err := runtime.DefaultUnstructuredConverter.ToUnstructured(old)
+	if err != nil {
+		logger.Error(err, "convert to unstructured failed")
+		return false
+	}
+	newU, err := runtime.DefaultUnstructuredConverter.ToUnstructured(new)
+	if err != nil {
+		logger.Error(err, "convert to unstructured failed")
+		return false
+	}
+	paths := append([]string{"metadata.resourceVersion"}, f.IgnorePaths...)
+	for _, p := range paths {
+		fields := strings.Split(p, ".")
+		unstructured.RemoveNestedField(oldU, fields...)
+		unstructured.RemoveNestedField(newU, fields...)
+	}
+	return equality.Semantic.DeepEqual(oldU, newU)
+}
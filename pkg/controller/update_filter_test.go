@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func deployment(generation int64, resourceVersion string, replicas int32, ready int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", Generation: generation, ResourceVersion: resourceVersion},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: ready},
+	}
+}
+
+func TestUpdateFilterGeneration(t *testing.T) {
+	f := &UpdateFilter{GenerationChanged: true}
+	logger := logr.Discard()
+	old := deployment(1, "1", 1, 0)
+	if !f.suppress(logger, old, old) {
+		t.Error("resync update must be suppressed")
+	}
+	if !f.suppress(logger, old, deployment(1, "2", 1, 1)) {
+		t.Error("status-only update with unchanged generation must be suppressed")
+	}
+	if f.suppress(logger, old, deployment(2, "3", 2, 0)) {
+		t.Error("update with changed generation must pass")
+	}
+
+	// pod 没有 generation，退化为比较 resourceVersion
+	oldPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", ResourceVersion: "1"}}
+	newPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", ResourceVersion: "2"}}
+	if f.suppress(logger, oldPod, newPod) {
+		t.Error("update of a kind without generation must pass")
+	}
+	var nilFilter *UpdateFilter
+	if nilFilter.suppress(logger, old, old) {
+		t.Error("nil filter must not suppress")
+	}
+}
+
+func TestUpdateFilterIgnorePaths(t *testing.T) {
+	f := &UpdateFilter{IgnorePaths: []string{"status", "metadata.managedFields"}}
+	logger := logr.Discard()
+	old := deployment(1, "1", 1, 0)
+	changedStatus := deployment(1, "2", 1, 1)
+	changedStatus.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubelet"}}
+	if !f.suppress(logger, old, changedStatus) {
+		t.Error("update differing only in ignored paths must be suppressed")
+	}
+	if f.suppress(logger, old, deployment(1, "3", 2, 0)) {
+		t.Error("spec change must pass")
+	}
+}
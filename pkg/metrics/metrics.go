@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"k8s.io/client-go/util/workqueue"
+	"sync"
+)
+
+// Namespace 所有指标名的前缀
+const Namespace = "multi_cluster_informer"
+
+// Registry 全局指标注册表，包含事件、队列、handler 指标
+// Go 运行时与进程指标由调用方通过 RegisterRuntimeCollectors 加入，避免与调用方自己的注册表重复
+var Registry = prometheus.NewRegistry()
+
+var (
+	// EventsReceived informer 收到的事件数，包括被断言过滤的事件
+	EventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_received_total",
+		Help:      "Number of events received from informers, by cluster, resource and event type.",
+	}, []string{"cluster", "resource", "event"})
+
+	// EventsFiltered 被断言过滤、没有进入队列的事件数
+	EventsFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_filtered_total",
+		Help:      "Number of events dropped by predicates before entering the queue.",
+	}, []string{"cluster", "resource", "event"})
+
+	// QueueLatency 从事件产生(QueueObject.CreateAt)到被取出的时间，重新入列的对象从第一次产生开始计算
+	QueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "queue_latency_seconds",
+		Help:      "Time from event creation to being popped from the queue.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"cluster", "resource"})
+
+	// HandlerDuration HandleObject 的耗时，包括中间件、handler 与 Reconciler
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling an object, including middlewares and the reconciler.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"cluster", "resource"})
+
+	// HandlerErrors HandleObject 返回错误的次数
+	HandlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "handler_errors_total",
+		Help:      "Number of objects whose handling returned an error.",
+	}, []string{"cluster", "resource"})
+
+	// Requeues 重新放入队列的次数
+	Requeues = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "requeues_total",
+		Help:      "Number of objects put back into the queue.",
+	}, []string{"cluster", "resource"})
+
+	// DeadLetters 超过最大重试次数被丢弃的对象数
+	DeadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "dead_letters_total",
+		Help:      "Number of objects dropped after exceeding the max requeue times.",
+	}, []string{"cluster", "resource"})
+)
+
+// workqueue 指标，name 为队列名
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current depth of the workqueue.",
+	}, []string{"name"})
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Total number of adds handled by the workqueue.",
+	}, []string{"name"})
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "queue_duration_seconds",
+		Help:      "How long an item stays in the workqueue before being requested.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_seconds",
+		Help:      "How long processing an item from the workqueue takes.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+	workqueueUnfinished = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "unfinished_work_seconds",
+		Help:      "How many seconds of work has been done that is in progress and hasn't been observed by work_duration.",
+	}, []string{"name"})
+	workqueueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "longest_running_processor_seconds",
+		Help:      "How many seconds has the longest running processor for the workqueue been running.",
+	}, []string{"name"})
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Total number of retries handled by the workqueue.",
+	}, []string{"name"})
+)
+
+func init() {
+	Registry.MustRegister(
+		EventsReceived, EventsFiltered, QueueLatency, HandlerDuration, HandlerErrors, Requeues, DeadLetters,
+		workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration,
+		workqueueUnfinished, workqueueLongestRunning, workqueueRetries,
+	)
+}
+
+var runtimeOnce sync.Once
+
+// RegisterRuntimeCollectors 在 Registry 中加入 Go 运行时与进程指标，可重复调用
+// 调用方已在自己的注册表中注册这些指标并同时暴露 Registry 时不要调用
+func RegisterRuntimeCollectors() {
+	runtimeOnce.Do(func() {
+		Registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	})
+}
+
+// RegisterWorkqueueProvider 将 client-go 的 workqueue 指标记录到 Registry
+// client-go 的 provider 是进程级的且只能设置一次，调用方已设置自己的 provider 时不会生效；
+// 只有之后创建的队列才会记录指标，需在创建控制器之前调用
+func RegisterWorkqueueProvider() {
+	workqueue.SetProvider(workqueueProvider{})
+}
+
+// workqueueProvider 实现 client-go 的 workqueue.MetricsProvider
+type workqueueProvider struct{}
+
+func (workqueueProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinished.WithLabelValues(name)
+}
+
+func (workqueueProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunning.WithLabelValues(name)
+}
+
+func (workqueueProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
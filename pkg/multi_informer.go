@@ -1,110 +1,130 @@
 package multi_informer
 
 import (
+	"context"
+	"fmt"
 	"github.com/practice/multi_cluster_informer/pkg/config"
 	"github.com/practice/multi_cluster_informer/pkg/controller"
-	"github.com/practice/multi_cluster_informer/pkg/queue"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/klog/v2"
+	"github.com/practice/multi_cluster_informer/pkg/registry"
+	"github.com/practice/multi_cluster_informer/pkg/tracing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"time"
 )
 
 // NewMultiClusterInformerFromConfig 输入配置文件目录，返回 MultiClusterInformer 对象
 // 推荐调用者直接使用此方法初始化对象
-func NewMultiClusterInformerFromConfig(path string) (controller.MultiClusterInformer, error) {
+func NewMultiClusterInformerFromConfig(path string, opts ...controller.Option) (controller.MultiClusterInformer, error) {
 
 	sysConfig, err := config.LoadConfig(path)
 	if err != nil {
-		klog.Error("load config error: ", err)
-		return nil, err
+		return nil, fmt.Errorf("load config [%v] failed: %w", path, err)
 	}
 
-	return NewMultiClusterInformer(sysConfig.MaxReQueueTime, sysConfig.Clusters)
+	// 开启热加载时，随控制器一起监听配置文件变化
+	var watch func(ctx context.Context, core controller.MultiClusterInformer)
+	if sysConfig.Reload != nil && sysConfig.Reload.Interval > 0 {
+		reloader := newConfigReloader(path, sysConfig)
+		watch = reloader.run
+	}
+	return newFromConfig(sysConfig, watch, opts...)
 }
 
-// NewMultiClusterInformer 入参：最大重回对列次数、集群对象列表
-func NewMultiClusterInformer(maxReQueueTime int, clusters []controller.Cluster) (controller.MultiClusterInformer, error) {
-	core := &controller.Controller{
-		Queue: queue.NewWorkQueue(maxReQueueTime),
-		StopC: make(chan struct{}, 1),
+// NewMultiClusterInformerFromHub 从 hub 集群读取 MultiClusterInformerConfig 对象，返回 MultiClusterInformer 对象
+// 配置了 reload 时监听该对象，变化立即应用，便于通过 GitOps 管理配置
+func NewMultiClusterInformerFromHub(hub controller.Cluster, namespace, name string, opts ...controller.Option) (controller.MultiClusterInformer, error) {
+	restConfig, err := hub.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := client.Resource(config.ConfigResource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sysConfig, err := config.LoadConfigFromObject(obj)
+	if err != nil {
+		return nil, fmt.Errorf("load config from [%v/%v] failed: %w", namespace, name, err)
+	}
+
+	var watch func(ctx context.Context, core controller.MultiClusterInformer)
+	if sysConfig.Reload != nil {
+		reloader := newObjectReloader(client, obj, sysConfig)
+		watch = reloader.run
 	}
+	return newFromConfig(sysConfig, watch, opts...)
+}
 
-	store := make(queue.MapIndexers)
-	informers := make(controller.InformerList, 0)
+// newFromConfig 根据配置创建控制器，watch 不为空时随控制器一起监听配置变化
+func newFromConfig(sysConfig *config.Config, watch func(ctx context.Context, core controller.MultiClusterInformer), opts ...controller.Option) (core controller.MultiClusterInformer, err error) {
+	// 配置中的选项在前，调用方传入的选项可覆盖
+	opts = append(sysConfig.Options(), opts...)
 
-	// 遍历所有集群，并初始化
-	for _, c := range clusters {
-		client, err := c.NewClient()
+	// 导出 trace，Run 结束时导出剩余的 span
+	if sysConfig.Tracing != nil {
+		var shutdown func(context.Context) error
+		shutdown, err = tracing.Setup(context.Background(), *sysConfig.Tracing)
 		if err != nil {
 			return nil, err
 		}
-		// 遍历所有资源，建立 indexer
-		for _, r := range c.MetaData.List {
-
-			// 当 namespace 为all时 单独处理
-			if r.Namespace == queue.All {
-				var indexerListRes []cache.Indexer
-				var informerListRes []cache.Controller
-				switch r.RType {
-				case queue.Deployments:
-					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Statefulsets:
-					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Daemonsets:
-					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Pods:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.ConfigMaps:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Secrets:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Services:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Events:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				}
-
-				for k, v := range indexerListRes {
-					if v != nil || informerListRes[k] != nil {
-						store[r.RType] = append(store[r.RType], v)
-						informers = append(informers, informerListRes[k])
-					}
-
-				}
-
-			} else {
-				var indexer cache.Indexer
-				var informer cache.Controller
-
-				switch r.RType {
-				case queue.Deployments:
-					indexer, informer = r.CreateAppsV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Statefulsets:
-					indexer, informer = r.CreateAppsV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Daemonsets:
-					indexer, informer = r.CreateAppsV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Pods:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.ConfigMaps:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Secrets:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Services:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				case queue.Events:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, c.MetaData.ClusterName)
-				}
-
-				// 放入 list中
-				store[r.RType] = append(store[r.RType], indexer)
-				informers = append(informers, informer)
-
+		// 之后的步骤失败时控制器不会运行，在这里关闭导出器；defer 读取的是命名返回值 err
+		defer func() {
+			if err != nil {
+				_ = shutdown(context.Background())
+			}
+		}()
+		opts = append(opts, controller.WithRunnable(func(ctx context.Context) {
+			<-ctx.Done()
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(flushCtx); err != nil {
+				controller.LoggerFrom(ctx).Error(err, "shutdown tracing failed")
 			}
+		}))
+	}
+	// 后台任务在 Run 时才启动，此时 core 已创建
+	if watch != nil {
+		opts = append(opts, controller.WithRunnable(func(ctx context.Context) {
+			watch(ctx, core)
+		}))
+	}
+	// 从 hub 集群的 Secret 中发现成员集群
+	if sysConfig.SecretRegistry != nil {
+		secretRegistry, err := registry.NewSecretRegistryFromConfig(*sysConfig.SecretRegistry)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, controller.WithRunnable(func(ctx context.Context) {
+			secretRegistry.Run(ctx, core)
+		}))
+	}
 
+	// 从 Cluster API 或 OCM 的集群清单中发现成员集群
+	if sysConfig.Inventory != nil {
+		inventory, err := registry.NewInventoryRegistryFromConfig(*sysConfig.Inventory)
+		if err != nil {
+			return nil, err
 		}
+		opts = append(opts, controller.WithRunnable(func(ctx context.Context) {
+			inventory.Run(ctx, core)
+		}))
 	}
 
-	core.Informers = informers
-	core.Store = store
+	core, err = NewMultiClusterInformer(sysConfig.MaxReQueueTime, sysConfig.Clusters, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return core, nil
+}
 
+// NewMultiClusterInformer 入参：最大重回对列次数、集群对象列表、控制器可选配置
+func NewMultiClusterInformer(maxReQueueTime int, clusters []controller.Cluster, opts ...controller.Option) (controller.MultiClusterInformer, error) {
+	core, err := controller.NewController(maxReQueueTime, clusters, opts...)
+	if err != nil {
+		return nil, err
+	}
 	return core, nil
 }
@@ -0,0 +1,189 @@
+package predicate
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"regexp"
+)
+
+// Event 断言所需的事件信息
+type Event struct {
+	ClusterName   string      // 集群名称
+	ClusterLabels labels.Set  // 集群标签
+	ResourceType  string      // 资源类型
+	EventType     string      // 事件类型：add update delete
+	Object        interface{} // 事件对象，update 时为新对象
+	OldObject     interface{} // 旧对象，仅 update 事件有值
+}
+
+// Predicate 事件断言，返回 false 时事件被过滤
+type Predicate func(e Event) bool
+
+// All 所有断言都通过才通过，空列表视为通过
+func All(predicates []Predicate, e Event) bool {
+	for _, p := range predicates {
+		if !p(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// And 组合断言：全部通过
+func And(predicates ...Predicate) Predicate {
+	return func(e Event) bool {
+		return All(predicates, e)
+	}
+}
+
+// Or 组合断言：任一通过
+func Or(predicates ...Predicate) Predicate {
+	return func(e Event) bool {
+		for _, p := range predicates {
+			if p(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not 取反
+func Not(p Predicate) Predicate {
+	return func(e Event) bool {
+		return !p(e)
+	}
+}
+
+// ClusterIn 集群在给定集合中
+func ClusterIn(clusters ...string) Predicate {
+	set := make(map[string]struct{}, len(clusters))
+	for _, c := range clusters {
+		set[c] = struct{}{}
+	}
+	return func(e Event) bool {
+		_, ok := set[e.ClusterName]
+		return ok
+	}
+}
+
+// ClusterSelector 集群标签匹配 selector，如 env=prod
+func ClusterSelector(selector labels.Selector) Predicate {
+	return func(e Event) bool {
+		return selector.Matches(e.ClusterLabels)
+	}
+}
+
+// ResourceIn 资源类型在给定集合中
+func ResourceIn(resources ...string) Predicate {
+	set := make(map[string]struct{}, len(resources))
+	for _, r := range resources {
+		set[r] = struct{}{}
+	}
+	return func(e Event) bool {
+		_, ok := set[e.ResourceType]
+		return ok
+	}
+}
+
+// EventTypeIn 事件类型在给定集合中，如 queue.EventAdd
+func EventTypeIn(events ...string) Predicate {
+	set := make(map[string]struct{}, len(events))
+	for _, ev := range events {
+		set[ev] = struct{}{}
+	}
+	return func(e Event) bool {
+		_, ok := set[e.EventType]
+		return ok
+	}
+}
+
+// NamespaceMatches namespace 匹配正则
+func NamespaceMatches(re *regexp.Regexp) Predicate {
+	return func(e Event) bool {
+		o, ok := accessor(e.Object)
+		if !ok {
+			return false
+		}
+		return re.MatchString(o.GetNamespace())
+	}
+}
+
+// LabelSelector 对象 label 满足 selector，可用 labels.Parse("app=nginx") 构造
+func LabelSelector(selector labels.Selector) Predicate {
+	return func(e Event) bool {
+		o, ok := accessor(e.Object)
+		if !ok {
+			return false
+		}
+		return selector.Matches(labels.Set(o.GetLabels()))
+	}
+}
+
+// GenerationChanged update 事件中 metadata.generation 发生变化，其他事件直接通过
+// 没有 generation 的资源（如 pods configmaps）generation 始终为 0，此时比较 metadata.resourceVersion
+func GenerationChanged() Predicate {
+	return func(e Event) bool {
+		if e.OldObject == nil {
+			return true
+		}
+		o, ok1 := accessor(e.Object)
+		old, ok2 := accessor(e.OldObject)
+		if !ok1 || !ok2 {
+			return true
+		}
+		if o.GetGeneration() == 0 && old.GetGeneration() == 0 {
+			return o.GetResourceVersion() != old.GetResourceVersion()
+		}
+		return o.GetGeneration() != old.GetGeneration()
+	}
+}
+
+// AnnotationChanged update 事件中给定的 annotation 发生变化，
+// 不传 key 时比较全部 annotation，其他事件直接通过
+func AnnotationChanged(keys ...string) Predicate {
+	return func(e Event) bool {
+		if e.OldObject == nil {
+			return true
+		}
+		o, ok1 := accessor(e.Object)
+		old, ok2 := accessor(e.OldObject)
+		if !ok1 || !ok2 {
+			return true
+		}
+		newAnno, oldAnno := o.GetAnnotations(), old.GetAnnotations()
+		if len(keys) == 0 {
+			if len(newAnno) != len(oldAnno) {
+				return true
+			}
+			for k, v := range newAnno {
+				if ov, ok := oldAnno[k]; !ok || ov != v {
+					return true
+				}
+			}
+			return false
+		}
+		for _, k := range keys {
+			nv, nok := newAnno[k]
+			ov, ook := oldAnno[k]
+			if nok != ook || nv != ov {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// accessor 取出对象的 metadata，兼容删除事件中的 DeletedFinalStateUnknown
+func accessor(obj interface{}) (metav1.Object, bool) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, false
+	}
+	return o, true
+}
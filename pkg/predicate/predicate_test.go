@@ -0,0 +1,90 @@
+package predicate
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"regexp"
+	"testing"
+)
+
+func pod(ns string, generation int64, lbs, anno map[string]string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "pod1", Namespace: ns, Generation: generation, Labels: lbs, Annotations: anno,
+	}}
+}
+
+func TestPredicates(test *testing.T) {
+	selector, err := labels.Parse("app=nginx")
+	if err != nil {
+		test.Fatal(err)
+	}
+	p := And(
+		ClusterIn("cluster1", "cluster2"),
+		NamespaceMatches(regexp.MustCompile(`^team-`)),
+		LabelSelector(selector),
+		Not(EventTypeIn("delete")),
+	)
+
+	cases := []struct {
+		name string
+		e    Event
+		want bool
+	}{
+		{"match", Event{ClusterName: "cluster1", EventType: "add", Object: pod("team-a", 1, map[string]string{"app": "nginx"}, nil)}, true},
+		{"other cluster", Event{ClusterName: "cluster3", EventType: "add", Object: pod("team-a", 1, map[string]string{"app": "nginx"}, nil)}, false},
+		{"namespace", Event{ClusterName: "cluster1", EventType: "add", Object: pod("default", 1, map[string]string{"app": "nginx"}, nil)}, false},
+		{"label", Event{ClusterName: "cluster1", EventType: "add", Object: pod("team-a", 1, nil, nil)}, false},
+		{"delete", Event{ClusterName: "cluster2", EventType: "delete", Object: cache.DeletedFinalStateUnknown{Obj: pod("team-a", 1, map[string]string{"app": "nginx"}, nil)}}, false},
+	}
+	for _, c := range cases {
+		if got := p(c.e); got != c.want {
+			test.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestChanged(test *testing.T) {
+	old := pod("default", 1, nil, map[string]string{"a": "1", "b": "1"})
+
+	if GenerationChanged()(Event{EventType: "update", Object: pod("default", 1, nil, nil), OldObject: old}) {
+		test.Error("generation unchanged must be filtered")
+	}
+	if !GenerationChanged()(Event{EventType: "update", Object: pod("default", 2, nil, nil), OldObject: old}) {
+		test.Error("generation changed must pass")
+	}
+	// 没有 generation 的资源比较 resourceVersion
+	noGen, noGenOld := pod("default", 0, nil, nil), pod("default", 0, nil, nil)
+	noGenOld.ResourceVersion, noGen.ResourceVersion = "1", "2"
+	if !GenerationChanged()(Event{EventType: "update", Object: noGen, OldObject: noGenOld}) {
+		test.Error("resourceVersion changed without generation must pass")
+	}
+	if GenerationChanged()(Event{EventType: "update", Object: noGenOld, OldObject: noGenOld}) {
+		test.Error("resourceVersion unchanged without generation must be filtered")
+	}
+	if !GenerationChanged()(Event{EventType: "add", Object: old}) {
+		test.Error("non-update events must pass")
+	}
+
+	changedB := pod("default", 1, nil, map[string]string{"a": "1", "b": "2"})
+	if AnnotationChanged("a")(Event{EventType: "update", Object: changedB, OldObject: old}) {
+		test.Error("annotation a unchanged must be filtered")
+	}
+	if !AnnotationChanged("b")(Event{EventType: "update", Object: changedB, OldObject: old}) {
+		test.Error("annotation b changed must pass")
+	}
+	if !AnnotationChanged()(Event{EventType: "update", Object: changedB, OldObject: old}) {
+		test.Error("any annotation changed must pass")
+	}
+}
+
+func TestClusterSelector(test *testing.T) {
+	prod := ClusterSelector(labels.SelectorFromSet(labels.Set{"env": "prod"}))
+	if !prod(Event{ClusterLabels: labels.Set{"env": "prod", "region": "eu-west-1"}}) {
+		test.Error("prod cluster must pass")
+	}
+	if prod(Event{ClusterLabels: labels.Set{"env": "dev"}}) || prod(Event{}) {
+		test.Error("non-prod cluster must be filtered")
+	}
+}
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryAfterError handler 返回此错误时，表示希望在指定延迟后重试，而不是走限速器的退避
+type RetryAfterError struct {
+	// Delay 延迟多久后重新入列
+	Delay time.Duration
+	// Err 原始错误，可为空
+	Err error
+}
+
+func (e *RetryAfterError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("retry after %v: %v", e.Delay, e.Err)
+	}
+	return fmt.Sprintf("retry after %v", e.Delay)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter 构造延迟重试错误，例如：证书 10 分钟后过期，到时再检查
+func RetryAfter(d time.Duration, err error) error {
+	return &RetryAfterError{Delay: d, Err: err}
+}
+
+// RetryAt 构造在 t 时刻重试的错误
+func RetryAt(t time.Time, err error) error {
+	return &RetryAfterError{Delay: time.Until(t), Err: err}
+}
+
+// IsRetryAfter 判断 err 是否为延迟重试错误，并返回延迟时间
+func IsRetryAfter(err error) (time.Duration, bool) {
+	var e *RetryAfterError
+	if errors.As(err, &e) {
+		return e.Delay, true
+	}
+	return 0, false
+}
+
+// PermanentError 不可重试的错误，调用方应直接 Finish 而不是重新入列
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent error: %v", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 将 err 标记为不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent 判断 err 是否为不可重试错误
+func IsPermanent(err error) bool {
+	var e *PermanentError
+	return errors.As(err, &e)
+}
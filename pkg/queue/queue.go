@@ -2,7 +2,12 @@ package queue
 
 import (
 	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sync/atomic"
+	"time"
 )
 
 // Queue 接口对象
@@ -11,12 +16,18 @@ type Queue interface {
 	Push(QueueObject)
 	// Pop 拿出队列
 	Pop() (QueueObject, error)
-	// ReQueue 重新放入队列，次数可配置
+	// ReQueue 重新放入队列，最多重试 MaxReQueueTime 次
 	ReQueue(QueueObject) error
+	// ReQueueAfter 延迟指定时间后重新放入队列，同样计入重试次数
+	ReQueueAfter(QueueObject, time.Duration) error
+	// ReQueueAt 在指定时间点重新放入队列，同样计入重试次数
+	ReQueueAt(QueueObject, time.Time) error
 	// Finish 完成入列操作
 	Finish(QueueObject)
 	// Close 关闭所有informer
 	Close()
+	// Drain 不再接收新对象，等待正在处理的对象 Finish 后关闭
+	Drain()
 	// SetReMaxReQueueTime 设置最大重新入列次数
 	SetReMaxReQueueTime(int)
 }
@@ -24,21 +35,44 @@ type Queue interface {
 // Wq 使用限速队列实现queue接口
 type Wq struct {
 	workqueue.RateLimitingInterface
-	MaxReQueueTime int
+	// maxReQueueTime 最大重试次数，Push 放入时不计入；热加载时会在处理对象的同时修改，所以使用原子操作
+	maxReQueueTime int64
+	// rateLimiter 与限速队列共用，延迟入列时用来累计重试次数
+	rateLimiter workqueue.RateLimiter
+	// Logger 记录超过最大重试次数被丢弃的对象，默认使用 klog
+	Logger logr.Logger
 }
 
 var _ Queue = &Wq{}
 
+// ErrMaxReQueue 超过最大重试次数，对象已被丢弃
+var ErrMaxReQueue = errors.New("This object has been requeued for many times, but still fails. ")
+
+// Name 默认工作队列名的前缀，队列名作为 workqueue 指标的 name 标签
+const Name = "multi_cluster_informer"
+
+// queueSeq 默认队列名的序号，同一进程中的多个队列指标不会冲突
+var queueSeq int32
+
+// NewWorkQueue 创建工作队列，队列名为 Name 加进程内递增的序号
 func NewWorkQueue(maxReQueueTime int) *Wq {
+	return NewNamedWorkQueue(maxReQueueTime, fmt.Sprintf("%s_%d", Name, atomic.AddInt32(&queueSeq, 1)))
+}
+
+// NewNamedWorkQueue 创建指定名称的工作队列，name 在进程内应唯一
+func NewNamedWorkQueue(maxReQueueTime int, name string) *Wq {
+	rateLimiter := workqueue.DefaultItemBasedRateLimiter()
 	return &Wq{
-		workqueue.NewRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter()),
-		maxReQueueTime,
+		RateLimitingInterface: workqueue.NewNamedRateLimitingQueue(rateLimiter, name),
+		maxReQueueTime:        int64(maxReQueueTime),
+		rateLimiter:           rateLimiter,
+		Logger:                klog.Background().WithName("queue"),
 	}
 }
 
-// Push 放入队列
+// Push 放入队列，不经过限速器，所以不计入重试次数
 func (c *Wq) Push(obj QueueObject) {
-	c.AddRateLimited(obj)
+	c.Add(obj)
 }
 
 // Pop 取出队列
@@ -58,21 +92,58 @@ func (c *Wq) Finish(obj QueueObject) {
 
 // ReQueue 重新放入
 func (c *Wq) ReQueue(obj QueueObject) error {
-	if c.NumRequeues(obj) < c.MaxReQueueTime {
-		// 这里会重新放入对列
+	if c.NumRequeues(obj) < c.MaxReQueueTime() {
+		// 这里会重新放入对列，需要 Done 后才会被再次取出
 		c.AddRateLimited(obj)
+		c.Done(obj)
 		return nil
 	}
 	// 如果次数大于最大重试次数，直接丢弃
+	c.drop(obj)
+	return ErrMaxReQueue
+}
+
+// ReQueueAfter 延迟 d 后重新放入，不走限速器的退避时间，但重试次数照常累计
+func (c *Wq) ReQueueAfter(obj QueueObject, d time.Duration) error {
+	if c.NumRequeues(obj) < c.MaxReQueueTime() {
+		// 只为了累计次数，退避时间由调用方指定
+		c.rateLimiter.When(obj)
+		c.AddAfter(obj, d)
+		c.Done(obj)
+		return nil
+	}
+	c.drop(obj)
+	return ErrMaxReQueue
+}
+
+// drop 丢弃超过最大重试次数的对象
+func (c *Wq) drop(obj QueueObject) {
+	c.Logger.Info("drop object after max requeue times",
+		"cluster", obj.ClusterName, "resource", obj.ResourceType, "key", obj.Key, "event", obj.Event, "requeues", c.NumRequeues(obj))
 	c.Forget(obj)
 	c.Done(obj)
-	return errors.New("This object has been requeued for many times, but still fails. ")
+}
+
+// ReQueueAt 在 t 时刻重新放入，t 已过去时立即放入
+func (c *Wq) ReQueueAt(obj QueueObject, t time.Time) error {
+	return c.ReQueueAfter(obj, time.Until(t))
 }
 
 func (c *Wq) Close() {
 	c.ShutDown()
 }
 
+// Drain 关闭前等待正在处理的对象完成，之后可再调用 Close 强制结束等待
+func (c *Wq) Drain() {
+	c.ShutDownWithDrain()
+}
+
+// SetReMaxReQueueTime 设置最大重试次数，可与 ReQueue 并发调用
 func (c *Wq) SetReMaxReQueueTime(maxReQueueTime int) {
-	c.MaxReQueueTime = maxReQueueTime
+	atomic.StoreInt64(&c.maxReQueueTime, int64(maxReQueueTime))
+}
+
+// MaxReQueueTime 返回最大重试次数
+func (c *Wq) MaxReQueueTime() int {
+	return int(atomic.LoadInt64(&c.maxReQueueTime))
 }
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReQueue(t *testing.T) {
+	q := NewWorkQueue(3)
+	defer q.Close()
+
+	q.Push(QueueObject{ClusterName: "cluster1", Event: EventAdd, ResourceType: Pods, Key: "default/pod1"})
+	obj, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Push 不计入重试次数，MaxReQueueTime 为 3 时可以重试 3 次
+	for i := 0; i < 3; i++ {
+		if err = q.ReQueue(obj); err != nil {
+			t.Fatalf("requeue %d: %v", i, err)
+		}
+		if obj, err = q.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = q.ReQueue(obj); !errors.Is(err, ErrMaxReQueue) {
+		t.Fatalf("expected ErrMaxReQueue, got %v", err)
+	}
+	if q.NumRequeues(obj) != 0 {
+		t.Fatalf("dropped object should be forgotten, got %d requeues", q.NumRequeues(obj))
+	}
+}
+
+func TestReQueueAfter(t *testing.T) {
+	q := NewWorkQueue(3)
+	defer q.Close()
+
+	q.Push(QueueObject{ClusterName: "cluster1", Event: EventAdd, ResourceType: Pods, Key: "default/pod1"})
+	obj, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err = q.ReQueueAfter(obj, 50*time.Millisecond); err != nil {
+			t.Fatalf("requeue %d: %v", i, err)
+		}
+		if obj, err = q.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) < 150*time.Millisecond {
+		t.Fatal("object was requeued before the requested delay")
+	}
+
+	// 超过最大次数后丢弃
+	if err = q.ReQueueAt(obj, time.Now()); !errors.Is(err, ErrMaxReQueue) {
+		t.Fatalf("expected ErrMaxReQueue, got %v", err)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("expected empty queue, got %d", q.Len())
+	}
+}
+
+func TestIsRetryAfter(t *testing.T) {
+	err := RetryAfter(10*time.Minute, errors.New("certificate not expired yet"))
+	wrapped := fmt.Errorf("handler: %w", err)
+	if d, ok := IsRetryAfter(wrapped); !ok || d != 10*time.Minute {
+		t.Fatalf("unexpected result: %v %v", d, ok)
+	}
+	if _, ok := IsRetryAfter(errors.New("other")); ok {
+		t.Fatal("plain error must not be a RetryAfterError")
+	}
+}
+
+func TestSetReMaxReQueueTimeConcurrent(t *testing.T) {
+	q := NewWorkQueue(1)
+	defer q.Close()
+
+	// 热加载修改最大重试次数时，处理中的对象可以同时重新入列
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			q.SetReMaxReQueueTime(i % 5)
+		}
+	}()
+	obj := QueueObject{ClusterName: "cluster1", Event: EventAdd, ResourceType: Pods, Key: "default/pod1"}
+	for i := 0; i < 100; i++ {
+		q.Push(obj)
+		got, err := q.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = q.ReQueueAfter(got, time.Hour)
+	}
+	<-done
+	if q.SetReMaxReQueueTime(7); q.MaxReQueueTime() != 7 {
+		t.Fatalf("max requeue time = %d, want 7", q.MaxReQueueTime())
+	}
+}
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"k8s.io/apimachinery/pkg/labels"
 	"time"
 )
 
@@ -25,15 +26,40 @@ const (
 	EventAdd    = "add"
 	EventUpdate = "update"
 	EventDelete = "delete"
+	// EventReconcile 调和请求，只包含集群、资源与 key，同一对象的多个事件在队列中合并为一个
+	EventReconcile = "reconcile"
+)
+
+// Cluster 集群事件的资源类型，Key 为集群名
+const Cluster = "cluster"
+
+// 集群事件类型，由集群健康检查产生
+const (
+	EventClusterUnhealthy = "cluster-unhealthy"
+	EventClusterRecovered = "cluster-recovered"
 )
 
 // QueueObject 入队对象
 // 用来包装经由informer收到的资源对象
 type QueueObject struct {
-	ClusterName  string      // 集群名称
-	Event        string      // 事件对象
-	ResourceType string      // 资源类型
-	Key          string      // <namespace>/<name>
-	Obj          interface{} // runtime.Object
-	CreateAt     time.Time   // 创建时间，也可以记录更新次数 与 更新时间
+	ClusterName   string      // 集群名称
+	ClusterLabels string      // 集群标签，格式为 k1=v1,k2=v2，保存为字符串以保证可作为 map key
+	Event         string      // 事件对象
+	ResourceType  string      // 资源类型
+	Key           string      // <namespace>/<name>
+	Obj           interface{} // runtime.Object
+	CreateAt      time.Time   // 创建时间，也可以记录更新次数 与 更新时间
+	TraceParent   string      // 入队时 ingest span 的 W3C traceparent，处理时的 span 以此建立 link，未开启 tracing 时为空
+}
+
+// ClusterLabelSet 解析集群标签
+func (qo QueueObject) ClusterLabelSet() labels.Set {
+	if qo.ClusterLabels == "" {
+		return labels.Set{}
+	}
+	set, err := labels.ConvertSelectorToLabelsMap(qo.ClusterLabels)
+	if err != nil {
+		return labels.Set{}
+	}
+	return set
 }
@@ -1,7 +1,10 @@
 package queue
 
 import (
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
+	"sort"
+	"sync"
 )
 
 // Store 本地缓存接口
@@ -12,10 +15,127 @@ type Store interface {
 	ListKeys(string) []string
 	// GetByKey 输入特定key，返回资源对象
 	GetByKey(r string, key string) (items []interface{}, exists bool)
+	// GetByClusterKey 输入集群名、资源类型与key，返回该集群中的资源对象
+	GetByClusterKey(cluster string, r string, key string) (item interface{}, exists bool)
+	// ListByClusterSelector 列出标签匹配 selector 的集群中的资源对象
+	ListByClusterSelector(r string, selector labels.Selector) []interface{}
 }
 
-var _ Store = MapIndexers{}
+var _ Store = &ClusterIndexers{}
 
+// ClusterIndexers 多集群本地缓存：集群名 -> 该集群的 MapIndexers
+// 集群可以在运行时加入或移除，所以需要加锁
+type ClusterIndexers struct {
+	mu       sync.RWMutex
+	clusters map[string]MapIndexers
+	// labels 集群标签
+	labels map[string]labels.Set
+}
+
+func NewClusterIndexers() *ClusterIndexers {
+	return &ClusterIndexers{clusters: make(map[string]MapIndexers), labels: make(map[string]labels.Set)}
+}
+
+// Set 加入或替换集群的缓存
+func (c *ClusterIndexers) Set(cluster string, mapIndexer MapIndexers) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clusters[cluster] = mapIndexer
+}
+
+// Delete 移除集群的缓存
+func (c *ClusterIndexers) Delete(cluster string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clusters, cluster)
+	delete(c.labels, cluster)
+}
+
+// SetLabels 设置集群标签
+func (c *ClusterIndexers) SetLabels(cluster string, l map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.labels[cluster] = labels.Set(l)
+}
+
+// ClusterNames 返回标签匹配 selector 的集群名，按名称排序
+func (c *ClusterIndexers) ClusterNames(selector labels.Selector) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.clusters))
+	for name := range c.clusters {
+		if selector.Matches(c.labels[name]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cluster 返回单个集群的缓存
+func (c *ClusterIndexers) Cluster(cluster string) (MapIndexers, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	mapIndexer, ok := c.clusters[cluster]
+	return mapIndexer, ok
+}
+
+func (c *ClusterIndexers) List(r string) (l []interface{}) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, mapIndexer := range c.clusters {
+		l = append(l, mapIndexer.List(r)...)
+	}
+	return
+}
+
+func (c *ClusterIndexers) ListByClusterSelector(r string, selector labels.Selector) (l []interface{}) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, mapIndexer := range c.clusters {
+		if selector.Matches(c.labels[name]) {
+			l = append(l, mapIndexer.List(r)...)
+		}
+	}
+	return
+}
+
+func (c *ClusterIndexers) ListKeys(r string) (keys []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, mapIndexer := range c.clusters {
+		keys = append(keys, mapIndexer.ListKeys(r)...)
+	}
+	return
+}
+
+func (c *ClusterIndexers) GetByKey(r string, key string) ([]interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var items []interface{}
+	ok := false
+	for _, mapIndexer := range c.clusters {
+		if l, exists := mapIndexer.GetByKey(r, key); exists {
+			ok = true
+			items = append(items, l...)
+		}
+	}
+	return items, ok
+}
+
+func (c *ClusterIndexers) GetByClusterKey(cluster string, r string, key string) (interface{}, bool) {
+	mapIndexer, ok := c.Cluster(cluster)
+	if !ok {
+		return nil, false
+	}
+	items, exists := mapIndexer.GetByKey(r, key)
+	if !exists {
+		return nil, false
+	}
+	return items[0], true
+}
+
+// MapIndexers 单集群本地缓存：资源类型 -> indexer list
 type MapIndexers map[string][]cache.Indexer
 
 func (mapIndexer MapIndexers) List(r string) (l []interface{}) {
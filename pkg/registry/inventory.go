@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"strings"
+	"time"
+)
+
+// 集群清单来源
+const (
+	// ProviderClusterAPI Cluster API 的 Cluster 对象，kubeconfig 默认在 Cluster API 创建的同 namespace 的 <name>-kubeconfig Secret 中
+	ProviderClusterAPI = "cluster-api"
+	// ProviderOCM Open Cluster Management 的 ManagedCluster 对象
+	// ManagedCluster 不带有 hub 可读取的 kubeconfig，OCM 也没有约定 Secret 的位置，
+	// 需要由其他组件(如 managed-serviceaccount addon 或自行编写的控制器)在 hub 上创建 Secret，并通过 SecretNamespace、SecretName 指定
+	ProviderOCM = "ocm"
+)
+
+var (
+	// ClusterAPIResource Cluster API 的 Cluster 资源
+	ClusterAPIResource = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+	// ManagedClusterResource OCM 的 ManagedCluster 资源
+	ManagedClusterResource = schema.GroupVersionResource{Group: "cluster.open-cluster-management.io", Version: "v1", Resource: "managedclusters"}
+)
+
+// InventoryConfig 从管理集群的集群清单中发现成员集群
+type InventoryConfig struct {
+	// Hub 管理集群的连接信息
+	Hub controller.MetaData `json:"hub" yaml:"hub"`
+	// Provider 集群清单来源：cluster-api 或 ocm
+	Provider string `json:"provider" yaml:"provider"`
+	// Namespace Cluster API 的 Cluster 所在 namespace，为空时为所有 namespace，ocm 不使用
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// LabelSelector 筛选集群对象的 label selector
+	LabelSelector string `json:"labelSelector" yaml:"labelSelector"`
+	// KubeConfigKey Secret data 中 kubeconfig 的 key，cluster-api 默认 value，ocm 默认 kubeconfig
+	KubeConfigKey string `json:"kubeConfigKey" yaml:"kubeConfigKey"`
+	// SecretNamespace kubeconfig Secret 所在 namespace 的模板，{name}、{namespace} 替换为集群对象的名称与 namespace
+	// cluster-api 默认 {namespace}，ocm 没有默认值，必须设置
+	SecretNamespace string `json:"secretNamespace" yaml:"secretNamespace"`
+	// SecretName kubeconfig Secret 名称的模板，cluster-api 默认 {name}-kubeconfig，ocm 没有默认值，必须设置
+	SecretName string `json:"secretName" yaml:"secretName"`
+	// ClusterNameLabel 成员集群名称的 label，默认 multi-cluster-informer/cluster-name，没有时使用对象名称
+	ClusterNameLabel string `json:"clusterNameLabel" yaml:"clusterNameLabel"`
+	// ReadyOnly 只加入已就绪的集群：cluster-api 为 status.controlPlaneReady，ocm 为 ManagedClusterConditionAvailable
+	ReadyOnly bool `json:"readyOnly" yaml:"readyOnly"`
+	// ResyncPeriod 重新读取 kubeconfig Secret 的周期，用于发现凭证轮换，默认 5m
+	ResyncPeriod time.Duration `json:"resyncPeriod" yaml:"resyncPeriod"`
+	// Insecure 连接成员集群时是否跳过证书认证
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// List 每个成员集群监听的资源
+	List []controller.ResourceAndNamespace `json:"list" yaml:"list"`
+	// EmitDeleteOnRemove 集群对象删除时，是否为该集群缓存中的所有对象放入 delete 事件
+	EmitDeleteOnRemove bool `json:"emitDeleteOnRemove" yaml:"emitDeleteOnRemove"`
+}
+
+// ErrOCMSecretRequired ocm 未设置 kubeconfig Secret 的位置
+var ErrOCMSecretRequired = errors.New("ocm inventory requires secretNamespace and secretName: ManagedCluster has no kubeconfig readable from the hub, another component must create the secret")
+
+// InventoryRegistry 监听 Cluster API 的 Cluster 或 OCM 的 ManagedCluster，自动加入、更新与移除成员集群
+type InventoryRegistry struct {
+	dynamicClient dynamic.Interface
+	client        kubernetes.Interface
+	config        InventoryConfig
+	resource      schema.GroupVersionResource
+}
+
+// NewInventoryRegistry dynamicClient 用于读取集群对象，client 用于读取 kubeconfig Secret
+func NewInventoryRegistry(dynamicClient dynamic.Interface, client kubernetes.Interface, config InventoryConfig) (*InventoryRegistry, error) {
+	r := &InventoryRegistry{dynamicClient: dynamicClient, client: client}
+	switch config.Provider {
+	case ProviderClusterAPI:
+		r.resource = ClusterAPIResource
+		if config.KubeConfigKey == "" {
+			config.KubeConfigKey = "value"
+		}
+		if config.SecretNamespace == "" {
+			config.SecretNamespace = "{namespace}"
+		}
+		if config.SecretName == "" {
+			config.SecretName = "{name}-kubeconfig"
+		}
+	case ProviderOCM:
+		r.resource = ManagedClusterResource
+		// ManagedCluster 是集群级资源
+		config.Namespace = ""
+		if config.KubeConfigKey == "" {
+			config.KubeConfigKey = "kubeconfig"
+		}
+		// 没有约定的 Secret 位置，未设置时直接失败，而不是每个集群都读取 Secret 失败
+		if config.SecretNamespace == "" || config.SecretName == "" {
+			return nil, ErrOCMSecretRequired
+		}
+	default:
+		return nil, fmt.Errorf("unknown inventory provider [%v]", config.Provider)
+	}
+	if config.ClusterNameLabel == "" {
+		config.ClusterNameLabel = DefaultClusterNameLabel
+	}
+	if config.ResyncPeriod <= 0 {
+		config.ResyncPeriod = 5 * time.Minute
+	}
+	r.config = config
+	return r, nil
+}
+
+// NewInventoryRegistryFromConfig 使用 config.Hub 创建管理集群客户端
+func NewInventoryRegistryFromConfig(config InventoryConfig) (*InventoryRegistry, error) {
+	hub := controller.Cluster{MetaData: config.Hub}
+	restConfig, err := hub.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewInventoryRegistry(dynamicClient, client, config)
+}
+
+// Run 监听集群对象并同步成员集群，阻塞直到 ctx 结束
+func (r *InventoryRegistry) Run(ctx context.Context, target ClusterManager) {
+	m := newMembers(target, controller.LoggerFrom(ctx).WithName("inventory-registry"))
+	informer := dynamicinformer.NewFilteredDynamicInformer(r.dynamicClient, r.resource, r.config.Namespace, r.config.ResyncPeriod, cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = r.config.LabelSelector
+		}).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.apply(ctx, m, obj)
+		},
+		UpdateFunc: func(_, new interface{}) {
+			r.apply(ctx, m, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err == nil {
+				m.remove(key, r.config.EmitDeleteOnRemove)
+			}
+		},
+	})
+	m.logger.Info("run inventory registry", "provider", r.config.Provider, "selector", r.config.LabelSelector)
+	informer.Run(ctx.Done())
+}
+
+// apply 读取集群对象对应的 kubeconfig Secret，转换为成员集群
+func (r *InventoryRegistry) apply(ctx context.Context, m *members, obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(u)
+	if err != nil {
+		return
+	}
+	if r.config.ReadyOnly && !r.ready(u) {
+		m.logger.V(2).Info("cluster is not ready, skip", "source", key)
+		m.remove(key, r.config.EmitDeleteOnRemove)
+		return
+	}
+
+	replacer := strings.NewReplacer("{name}", u.GetName(), "{namespace}", u.GetNamespace())
+	secretNamespace := replacer.Replace(r.config.SecretNamespace)
+	secretName := replacer.Replace(r.config.SecretName)
+	secret, err := r.client.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		m.logger.Error(err, "get kubeconfig secret failed", "secret", secretNamespace+"/"+secretName, "source", key)
+		return
+	}
+	kubeConfig := secret.Data[r.config.KubeConfigKey]
+	if len(kubeConfig) == 0 {
+		m.logger.Info("secret has no kubeconfig key, skip", "secret", secretNamespace+"/"+secretName, "kubeConfigKey", r.config.KubeConfigKey)
+		m.remove(key, r.config.EmitDeleteOnRemove)
+		return
+	}
+
+	name := u.GetLabels()[r.config.ClusterNameLabel]
+	if name == "" {
+		name = u.GetName()
+	}
+	m.apply(key, controller.Cluster{MetaData: controller.MetaData{
+		ClusterName: name,
+		KubeConfig:  string(kubeConfig),
+		Insecure:    r.config.Insecure,
+		List:        r.config.List,
+		// 集群对象的标签作为集群标签，可被 ClusterSet 与断言选择
+		Labels: u.GetLabels(),
+	}})
+}
+
+// ready 集群对象是否已就绪
+func (r *InventoryRegistry) ready(u *unstructured.Unstructured) bool {
+	switch r.config.Provider {
+	case ProviderClusterAPI:
+		ready, _, _ := unstructured.NestedBool(u.Object, "status", "controlPlaneReady")
+		return ready
+	case ProviderOCM:
+		conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+		for _, c := range conditions {
+			cond, ok := c.(map[string]interface{})
+			if ok && cond["type"] == "ManagedClusterConditionAvailable" {
+				return cond["status"] == "True"
+			}
+		}
+	}
+	return false
+}
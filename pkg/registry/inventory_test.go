@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func capiCluster(name string, ready bool) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.x-k8s.io/v1beta1",
+		"kind":       "Cluster",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "fleet"},
+		"status":     map[string]interface{}{"controlPlaneReady": ready},
+	}}
+}
+
+func managedCluster(name string, available string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.open-cluster-management.io/v1",
+		"kind":       "ManagedCluster",
+		"metadata":   map[string]interface{}{"name": name},
+		"status": map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "ManagedClusterConditionAvailable", "status": available},
+		}},
+	}}
+}
+
+func kubeConfigSecret(namespace, name, key, value string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string][]byte{key: []byte(value)},
+	}
+}
+
+func newDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ClusterAPIResource:     "ClusterList",
+		ManagedClusterResource: "ManagedClusterList",
+	}, objects...)
+}
+
+func TestInventoryRegistryClusterAPI(t *testing.T) {
+	dynamicClient := newDynamicClient(capiCluster("workload1", true), capiCluster("provisioning", false))
+	client := fake.NewSimpleClientset(
+		kubeConfigSecret("fleet", "workload1-kubeconfig", "value", "kubeconfig-1"),
+		kubeConfigSecret("fleet", "provisioning-kubeconfig", "value", "kubeconfig-2"),
+	)
+	r, err := NewInventoryRegistry(dynamicClient, client, InventoryConfig{Provider: ProviderClusterAPI, Namespace: "fleet", ReadyOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := newFakeManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, manager)
+
+	eventually(t, func() bool {
+		kubeConfig, ok := manager.get("workload1")
+		return ok && kubeConfig == "kubeconfig-1"
+	})
+	if _, ok := manager.get("provisioning"); ok {
+		t.Fatal("cluster that is not ready must not be added")
+	}
+
+	// 就绪后加入
+	if _, err = dynamicClient.Resource(ClusterAPIResource).Namespace("fleet").Update(ctx, capiCluster("provisioning", true), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := manager.get("provisioning")
+		return ok
+	})
+
+	// 删除后移除
+	if err = dynamicClient.Resource(ClusterAPIResource).Namespace("fleet").Delete(ctx, "workload1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := manager.get("workload1")
+		return !ok
+	})
+}
+
+func TestInventoryRegistryOCM(t *testing.T) {
+	dynamicClient := newDynamicClient(managedCluster("spoke1", "True"))
+	client := fake.NewSimpleClientset(kubeConfigSecret("spoke1", "spoke1-kubeconfig", "kubeconfig", "kubeconfig-1"))
+	r, err := NewInventoryRegistry(dynamicClient, client, InventoryConfig{Provider: ProviderOCM, ReadyOnly: true, SecretNamespace: "{name}", SecretName: "{name}-kubeconfig"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := newFakeManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, manager)
+
+	eventually(t, func() bool {
+		kubeConfig, ok := manager.get("spoke1")
+		return ok && kubeConfig == "kubeconfig-1"
+	})
+
+	// 不可用时移除
+	if _, err = dynamicClient.Resource(ManagedClusterResource).Update(ctx, managedCluster("spoke1", "Unknown"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := manager.get("spoke1")
+		return !ok
+	})
+}
+
+func TestInventoryRegistryUnknownProvider(t *testing.T) {
+	if _, err := NewInventoryRegistry(newDynamicClient(), fake.NewSimpleClientset(), InventoryConfig{Provider: "rancher"}); err == nil {
+		t.Fatal("unknown provider must be rejected")
+	}
+	// ocm 没有约定的 kubeconfig Secret，必须指定
+	if _, err := NewInventoryRegistry(newDynamicClient(), fake.NewSimpleClientset(), InventoryConfig{Provider: ProviderOCM}); !errors.Is(err, ErrOCMSecretRequired) {
+		t.Fatalf("expected ErrOCMSecretRequired, got %v", err)
+	}
+}
+
+func TestInventoryRegistryMissingKubeConfigKey(t *testing.T) {
+	dynamicClient := newDynamicClient(capiCluster("workload1", true))
+	client := fake.NewSimpleClientset(kubeConfigSecret("fleet", "workload1-kubeconfig", "value", "kubeconfig-1"))
+	r, err := NewInventoryRegistry(dynamicClient, client, InventoryConfig{Provider: ProviderClusterAPI, Namespace: "fleet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := newFakeManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, manager)
+
+	eventually(t, func() bool {
+		_, ok := manager.get("workload1")
+		return ok
+	})
+
+	// Secret 中的 kubeconfig 被删除后，集群对象再次变化时移除
+	if _, err = client.CoreV1().Secrets("fleet").Update(ctx, kubeConfigSecret("fleet", "workload1-kubeconfig", "other", "x"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	obj := capiCluster("workload1", true)
+	obj.SetLabels(map[string]string{"env": "prod"})
+	if _, err = dynamicClient.Resource(ClusterAPIResource).Namespace("fleet").Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := manager.get("workload1")
+		return !ok
+	})
+}
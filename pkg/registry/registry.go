@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"reflect"
+	"sync"
+)
+
+// ClusterManager 集群的加入、替换与移除，controller.MultiClusterInformer 实现了此接口
+type ClusterManager interface {
+	AddCluster(cluster controller.Cluster) error
+	UpdateCluster(cluster controller.Cluster) error
+	RemoveCluster(name string, emitDelete bool) error
+}
+
+// DefaultClusterNameLabel 成员集群名称的 label，没有时使用对象名称
+const DefaultClusterNameLabel = "multi-cluster-informer/cluster-name"
+
+// members 记录由集群来源加入的成员集群：来源对象 key -> 集群
+// 只移除自己加入的集群，不影响配置文件中的集群
+type members struct {
+	mu       sync.Mutex
+	target   ClusterManager
+	clusters map[string]controller.Cluster
+	logger   logr.Logger
+}
+
+func newMembers(target ClusterManager, logger logr.Logger) *members {
+	return &members{target: target, clusters: make(map[string]controller.Cluster), logger: logger}
+}
+
+// apply 加入或更新成员集群，集群配置没有变化时不做处理
+func (m *members) apply(key string, cluster controller.Cluster) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.clusters[key]
+	// 比较完整的集群配置，标签、资源列表、Insecure 的变化同样需要更新
+	if ok && reflect.DeepEqual(old, cluster) {
+		return
+	}
+	// 集群名称变化，先移除旧的
+	if ok && old.MetaData.ClusterName != cluster.MetaData.ClusterName {
+		m.removeLocked(key, false)
+	}
+
+	var err error
+	if ok && old.MetaData.ClusterName == cluster.MetaData.ClusterName {
+		err = m.target.UpdateCluster(cluster)
+	} else {
+		err = m.target.AddCluster(cluster)
+	}
+	if err != nil {
+		m.logger.Error(err, "apply cluster failed", "cluster", cluster.MetaData.ClusterName, "source", key)
+		return
+	}
+	m.clusters[key] = cluster
+}
+
+// remove 移除成员集群
+func (m *members) remove(key string, emitDelete bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(key, emitDelete)
+}
+
+func (m *members) removeLocked(key string, emitDelete bool) {
+	old, ok := m.clusters[key]
+	if !ok {
+		return
+	}
+	delete(m.clusters, key)
+	if err := m.target.RemoveCluster(old.MetaData.ClusterName, emitDelete); err != nil {
+		m.logger.Error(err, "remove cluster failed", "cluster", old.MetaData.ClusterName, "source", key)
+	}
+}
@@ -0,0 +1,32 @@
+package registry
+
+import (
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"k8s.io/klog/v2"
+	"testing"
+)
+
+func TestMembersApply(t *testing.T) {
+	manager := newFakeManager()
+	m := newMembers(manager, klog.Background())
+	cluster := controller.Cluster{MetaData: controller.MetaData{ClusterName: "cluster1", KubeConfig: "kubeconfig"}}
+	m.apply("default/cluster1", cluster)
+	m.apply("default/cluster1", cluster)
+	if manager.updates != 0 {
+		t.Fatalf("unchanged cluster must not be updated, got %d updates", manager.updates)
+	}
+
+	// 标签、资源列表、Insecure 变化时更新
+	cluster.MetaData.Labels = map[string]string{"env": "prod"}
+	m.apply("default/cluster1", cluster)
+	cluster.MetaData.List = []controller.ResourceAndNamespace{{RType: "pods", Namespace: "default"}}
+	m.apply("default/cluster1", cluster)
+	cluster.MetaData.Insecure = true
+	m.apply("default/cluster1", cluster)
+	if manager.updates != 3 {
+		t.Fatalf("expected 3 updates, got %d", manager.updates)
+	}
+	if got := manager.clusters["cluster1"]; !got.MetaData.Insecure || len(got.MetaData.List) != 1 || got.MetaData.Labels["env"] != "prod" {
+		t.Fatalf("unexpected cluster: %+v", got.MetaData)
+	}
+}
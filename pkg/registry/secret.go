@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"context"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SecretRegistryConfig 从 hub 集群的 Secret 中发现成员集群，每个 Secret 保存一个成员集群的 kubeconfig
+type SecretRegistryConfig struct {
+	// Hub hub 集群的连接信息
+	Hub controller.MetaData `json:"hub" yaml:"hub"`
+	// Namespace Secret 所在的 namespace，为空时为所有 namespace
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// LabelSelector 筛选 Secret 的 label selector，如 multi-cluster-informer/cluster=true
+	LabelSelector string `json:"labelSelector" yaml:"labelSelector"`
+	// KubeConfigKey Secret data 中 kubeconfig 的 key，默认 kubeconfig
+	KubeConfigKey string `json:"kubeConfigKey" yaml:"kubeConfigKey"`
+	// ClusterNameLabel 成员集群名称的 label，默认 multi-cluster-informer/cluster-name，没有时使用 Secret 名称
+	ClusterNameLabel string `json:"clusterNameLabel" yaml:"clusterNameLabel"`
+	// Insecure 连接成员集群时是否跳过证书认证
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// List 每个成员集群监听的资源
+	List []controller.ResourceAndNamespace `json:"list" yaml:"list"`
+	// EmitDeleteOnRemove Secret 删除时，是否为该集群缓存中的所有对象放入 delete 事件
+	EmitDeleteOnRemove bool `json:"emitDeleteOnRemove" yaml:"emitDeleteOnRemove"`
+}
+
+// SecretRegistry 监听 hub 集群中的 Secret，自动加入、更新（凭证轮换）与移除成员集群
+type SecretRegistry struct {
+	client kubernetes.Interface
+	config SecretRegistryConfig
+}
+
+// NewSecretRegistry client 为 hub 集群的客户端
+func NewSecretRegistry(client kubernetes.Interface, config SecretRegistryConfig) *SecretRegistry {
+	if config.KubeConfigKey == "" {
+		config.KubeConfigKey = "kubeconfig"
+	}
+	if config.ClusterNameLabel == "" {
+		config.ClusterNameLabel = DefaultClusterNameLabel
+	}
+	return &SecretRegistry{client: client, config: config}
+}
+
+// NewSecretRegistryFromConfig 使用 config.Hub 创建 hub 集群客户端
+func NewSecretRegistryFromConfig(config SecretRegistryConfig) (*SecretRegistry, error) {
+	hub := controller.Cluster{MetaData: config.Hub}
+	client, err := hub.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretRegistry(client, config), nil
+}
+
+// Run 监听 Secret 并同步成员集群，阻塞直到 ctx 结束
+func (s *SecretRegistry) Run(ctx context.Context, target ClusterManager) {
+	m := newMembers(target, controller.LoggerFrom(ctx).WithName("secret-registry"))
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = s.config.LabelSelector
+			return s.client.CoreV1().Secrets(s.config.Namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = s.config.LabelSelector
+			return s.client.CoreV1().Secrets(s.config.Namespace).Watch(ctx, options)
+		},
+	}
+	_, informer := cache.NewInformer(lw, &v1.Secret{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.apply(m, obj)
+		},
+		UpdateFunc: func(_, new interface{}) {
+			s.apply(m, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err == nil {
+				m.remove(key, s.config.EmitDeleteOnRemove)
+			}
+		},
+	})
+	m.logger.Info("run secret registry", "namespace", s.config.Namespace, "selector", s.config.LabelSelector)
+	informer.Run(ctx.Done())
+}
+
+// apply 将 Secret 转换为成员集群
+func (s *SecretRegistry) apply(m *members, obj interface{}) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(secret)
+	if err != nil {
+		return
+	}
+	kubeConfig, ok := secret.Data[s.config.KubeConfigKey]
+	if !ok || len(kubeConfig) == 0 {
+		m.logger.Info("secret has no kubeconfig key, skip", "secret", key, "kubeConfigKey", s.config.KubeConfigKey)
+		m.remove(key, s.config.EmitDeleteOnRemove)
+		return
+	}
+	name := secret.Labels[s.config.ClusterNameLabel]
+	if name == "" {
+		name = secret.Name
+	}
+	m.apply(key, controller.Cluster{MetaData: controller.MetaData{
+		ClusterName: name,
+		KubeConfig:  string(kubeConfig),
+		Insecure:    s.config.Insecure,
+		List:        s.config.List,
+		// 集群对象的标签作为集群标签，可被 ClusterSet 与断言选择
+		Labels: secret.Labels,
+	}})
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeManager 记录集群变更
+type fakeManager struct {
+	mu       sync.Mutex
+	clusters map[string]controller.Cluster
+	updates  int
+}
+
+func newFakeManager() *fakeManager {
+	return &fakeManager{clusters: make(map[string]controller.Cluster)}
+}
+
+func (f *fakeManager) AddCluster(cluster controller.Cluster) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clusters[cluster.MetaData.ClusterName]; ok {
+		return fmt.Errorf("cluster [%v] already exists", cluster.MetaData.ClusterName)
+	}
+	f.clusters[cluster.MetaData.ClusterName] = cluster
+	return nil
+}
+
+func (f *fakeManager) UpdateCluster(cluster controller.Cluster) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clusters[cluster.MetaData.ClusterName] = cluster
+	f.updates++
+	return nil
+}
+
+func (f *fakeManager) RemoveCluster(name string, _ bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.clusters, name)
+	return nil
+}
+
+// get 返回集群的 kubeconfig
+func (f *fakeManager) get(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.clusters[name]
+	return c.MetaData.KubeConfig, ok
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSecretRegistry(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "member1", Namespace: "clusters",
+			Labels: map[string]string{"multi-cluster-informer/cluster": "true", DefaultClusterNameLabel: "prod-eu"},
+		},
+		Data: map[string][]byte{"kubeconfig": []byte("v1")},
+	}
+	ignored := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "clusters"},
+		Data:       map[string][]byte{"kubeconfig": []byte("v1")},
+	}
+	client := fake.NewSimpleClientset(secret, ignored)
+	manager := newFakeManager()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewSecretRegistry(client, SecretRegistryConfig{Namespace: "clusters", LabelSelector: "multi-cluster-informer/cluster=true"})
+	go r.Run(ctx, manager)
+
+	// 加入
+	eventually(t, func() bool {
+		kubeConfig, ok := manager.get("prod-eu")
+		return ok && kubeConfig == "v1"
+	})
+	if _, ok := manager.get("other"); ok {
+		t.Fatal("secret without matching label must be ignored")
+	}
+
+	// 凭证轮换
+	rotated := secret.DeepCopy()
+	rotated.Data["kubeconfig"] = []byte("v2")
+	if _, err := client.CoreV1().Secrets("clusters").Update(ctx, rotated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		kubeConfig, _ := manager.get("prod-eu")
+		return kubeConfig == "v2"
+	})
+
+	// 移除
+	if err := client.CoreV1().Secrets("clusters").Delete(ctx, "member1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok := manager.get("prod-eu")
+		return !ok
+	})
+}
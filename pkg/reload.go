@@ -0,0 +1,308 @@
+package multi_informer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/practice/multi_cluster_informer/pkg/config"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"reflect"
+	"time"
+)
+
+// configReloader 定期检查配置文件，变化时应用到控制器
+// 新配置无效时拒绝，继续使用旧配置
+type configReloader struct {
+	path    string
+	current *config.Config
+	// raw 最近一次读取的文件内容，内容不变时不重新加载
+	raw []byte
+	// logger run 时替换为控制器的 logger
+	logger logr.Logger
+}
+
+func newConfigReloader(path string, current *config.Config) *configReloader {
+	r := &configReloader{path: path, current: current, logger: klog.Background().WithName("reload")}
+	r.raw, _ = r.read()
+	return r
+}
+
+// read 读取配置文件及其 include 的所有文件，任一文件变化都会触发重新加载
+func (r *configReloader) read() ([]byte, error) {
+	sources := r.current.Sources()
+	if len(sources) == 0 {
+		sources = []string{r.path}
+	}
+	var raw []byte
+	for _, source := range sources {
+		b, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, b...)
+	}
+	return raw, nil
+}
+
+// run 随控制器运行，变化应用到 core
+func (r *configReloader) run(ctx context.Context, core controller.MultiClusterInformer) {
+	r.logger = controller.LoggerFrom(ctx).WithName("reload").WithValues("path", r.path)
+	ticker := time.NewTicker(r.current.Reload.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(core)
+		}
+	}
+}
+
+// check 文件内容变化时重新加载
+func (r *configReloader) check(core controller.MultiClusterInformer) {
+	raw, err := r.read()
+	if err != nil {
+		r.logger.Error(err, "read config file failed")
+		return
+	}
+	if bytes.Equal(raw, r.raw) {
+		return
+	}
+	// 校验前就记录新内容：无效的配置只拒绝一次，文件再次变化时才重试；
+	// 拒绝后 r.current 仍是最后一次生效的配置
+	r.raw = raw
+
+	r.logger.Info("config file changed, reloading")
+	newConfig, err := config.LoadConfig(r.path)
+	if err != nil {
+		r.logger.Error(err, "reject new config, keep the old one running")
+		return
+	}
+	if r.update(core, newConfig) {
+		// 清空记录的内容，下次检查时重新加载，只重试失败的集群
+		r.raw = nil
+		return
+	}
+	// include 的文件可能有增减，按新配置重新记录
+	r.raw, _ = r.read()
+}
+
+// update 应用新配置并记录实际生效的部分，返回 true 时有集群应用失败，需要重试
+// 新配置无效时只拒绝，不重试
+func (r *configReloader) update(core controller.MultiClusterInformer, newConfig *config.Config) (retry bool) {
+	applied, err := r.apply(core, newConfig)
+	if applied == nil {
+		r.logger.Error(err, "reject new config, keep the old one running")
+		return false
+	}
+	r.current = applied
+	if err != nil {
+		r.logger.Error(err, "some clusters failed to apply, retry on the next check")
+		return true
+	}
+	return false
+}
+
+// apply 先校验新配置，再对比新旧集群列表：新增的启动，移除的停止，变化的替换
+// 返回实际生效的配置：应用失败的集群保持旧的状态，下次对比时重试；新配置无效时返回 nil
+// 有集群应用失败时同时返回合并的错误
+func (r *configReloader) apply(core controller.MultiClusterInformer, newConfig *config.Config) (*config.Config, error) {
+	oldClusters := make(map[string]controller.Cluster, len(r.current.Clusters))
+	for _, c := range r.current.Clusters {
+		oldClusters[c.MetaData.ClusterName] = c
+	}
+	newClusters := make(map[string]controller.Cluster, len(newConfig.Clusters))
+	for _, c := range newConfig.Clusters {
+		name := c.MetaData.ClusterName
+		if name == "" {
+			return nil, fmt.Errorf("cluster name is empty")
+		}
+		if _, ok := newClusters[name]; ok {
+			return nil, fmt.Errorf("duplicate cluster name [%v]", name)
+		}
+		newClusters[name] = c
+	}
+
+	var added, updated []controller.Cluster
+	var removed []string
+	for name, c := range newClusters {
+		old, ok := oldClusters[name]
+		switch {
+		case !ok:
+			added = append(added, c)
+		case !reflect.DeepEqual(old, c):
+			updated = append(updated, c)
+		}
+	}
+	for name := range oldClusters {
+		if _, ok := newClusters[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	// 应用前确认新增与变化的集群都能创建客户端
+	for _, c := range append(added, updated...) {
+		if _, err := c.NewClient(); err != nil {
+			return nil, fmt.Errorf("cluster [%v]: %v", c.MetaData.ClusterName, err)
+		}
+	}
+
+	// failed 应用失败的集群名 -> 旧配置中的集群，不在旧配置中时为空
+	failed := make(map[string]*controller.Cluster)
+	var errs []error
+	for _, name := range removed {
+		if err := core.RemoveCluster(name, newConfig.Reload != nil && newConfig.Reload.EmitDeleteOnRemove); err != nil {
+			old := oldClusters[name]
+			failed[name] = &old
+			errs = append(errs, fmt.Errorf("remove cluster [%v]: %w", name, err))
+		}
+	}
+	for _, c := range updated {
+		if err := core.UpdateCluster(c); err != nil {
+			old := oldClusters[c.MetaData.ClusterName]
+			failed[c.MetaData.ClusterName] = &old
+			errs = append(errs, fmt.Errorf("update cluster [%v]: %w", c.MetaData.ClusterName, err))
+		}
+	}
+	for _, c := range added {
+		if err := core.AddCluster(c); err != nil {
+			failed[c.MetaData.ClusterName] = nil
+			errs = append(errs, fmt.Errorf("add cluster [%v]: %w", c.MetaData.ClusterName, err))
+		}
+	}
+	if newConfig.MaxReQueueTime != r.current.MaxReQueueTime {
+		core.SetReMaxReQueueTime(newConfig.MaxReQueueTime)
+	}
+	if changed := restartRequired(r.current, newConfig); len(changed) > 0 {
+		r.logger.Info("settings changed but not applied, restart to take effect", "settings", changed)
+	}
+	r.logger.Info("config reloaded", "added", len(added), "updated", len(updated), "removed", len(removed), "failed", len(failed))
+	if len(failed) == 0 {
+		return newConfig, nil
+	}
+
+	// 生效的集群列表：应用失败的集群恢复为旧配置，新增失败的不记录
+	applied := *newConfig
+	applied.Clusters = make([]controller.Cluster, 0, len(newConfig.Clusters))
+	for _, c := range newConfig.Clusters {
+		old, ok := failed[c.MetaData.ClusterName]
+		switch {
+		case !ok:
+			applied.Clusters = append(applied.Clusters, c)
+		case old != nil:
+			applied.Clusters = append(applied.Clusters, *old)
+		}
+	}
+	for _, name := range removed {
+		if old, ok := failed[name]; ok {
+			applied.Clusters = append(applied.Clusters, *old)
+		}
+	}
+	return &applied, utilerrors.NewAggregate(errs)
+}
+
+// restartRequired 返回有变化、但热加载不会应用的配置项
+// 热加载只应用集群列表与 maxRequeueTime，defaults 与 kubeConfigContexts 已展开到集群中
+func restartRequired(old, new *config.Config) []string {
+	settings := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"cacheSyncTimeout", old.CacheSyncTimeout, new.CacheSyncTimeout},
+		{"reload.interval", reloadInterval(old), reloadInterval(new)},
+		{"healthCheck", old.HealthCheck, new.HealthCheck},
+		{"server", old.Server, new.Server},
+		{"tracing", old.Tracing, new.Tracing},
+		{"secretRegistry", old.SecretRegistry, new.SecretRegistry},
+		{"inventory", old.Inventory, new.Inventory},
+		{"leaderElection", old.LeaderElection, new.LeaderElection},
+		{"sharding", old.Sharding, new.Sharding},
+		{"clusterSets", old.ClusterSets, new.ClusterSets},
+	}
+	var changed []string
+	for _, s := range settings {
+		if !reflect.DeepEqual(s.old, s.new) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+func reloadInterval(c *config.Config) time.Duration {
+	if c.Reload == nil {
+		return 0
+	}
+	return c.Reload.Interval
+}
+
+// objectReloader 监听 hub 集群中的 MultiClusterInformerConfig 对象，spec 变化时应用到控制器
+type objectReloader struct {
+	client    dynamic.Interface
+	namespace string
+	name      string
+	// generation 最近一次应用的对象 generation，spec 变化时 generation 才会增加
+	generation int64
+	*configReloader
+}
+
+func newObjectReloader(client dynamic.Interface, obj *unstructured.Unstructured, current *config.Config) *objectReloader {
+	return &objectReloader{
+		client:         client,
+		namespace:      obj.GetNamespace(),
+		name:           obj.GetName(),
+		generation:     obj.GetGeneration(),
+		configReloader: &configReloader{current: current, logger: klog.Background().WithName("reload")},
+	}
+}
+
+// run 随控制器运行，对象变化应用到 core
+func (r *objectReloader) run(ctx context.Context, core controller.MultiClusterInformer) {
+	r.logger = controller.LoggerFrom(ctx).WithName("reload").WithValues("object", r.namespace+"/"+r.name)
+	// 按 reload.interval resync，应用失败的集群在 resync 时重试
+	informer := dynamicinformer.NewFilteredDynamicInformer(r.client, config.ConfigResource, r.namespace, reloadInterval(r.current), cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", r.name).String()
+	}).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.check(core, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			r.check(core, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			r.logger.Info("config object deleted, keep the current config running")
+		},
+	})
+	informer.Run(ctx.Done())
+}
+
+// check generation 变化时重新加载，事件在 informer 的单个 goroutine 中串行处理
+func (r *objectReloader) check(core controller.MultiClusterInformer, obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u.GetGeneration() == r.generation {
+		return
+	}
+	r.generation = u.GetGeneration()
+
+	r.logger.Info("config object changed, reloading", "generation", r.generation)
+	newConfig, err := config.LoadConfigFromObject(u)
+	if err != nil {
+		r.logger.Error(err, "reject new config, keep the old one running")
+		return
+	}
+	if r.update(core, newConfig) {
+		// 清空记录的 generation，informer 下次 resync 或对象变化时重新加载，只重试失败的集群
+		r.generation = 0
+	}
+}
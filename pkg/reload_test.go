@@ -0,0 +1,166 @@
+package multi_informer
+
+import (
+	"errors"
+	"github.com/practice/multi_cluster_informer/pkg/config"
+	"github.com/practice/multi_cluster_informer/pkg/controller"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fakeCore 记录热加载应用到控制器的变化
+type fakeCore struct {
+	controller.MultiClusterInformer
+	added, updated, removed []string
+	maxReQueueTime          int
+	// failAdd 集群名 -> AddCluster 还需失败的次数
+	failAdd map[string]int
+}
+
+func (f *fakeCore) AddCluster(c controller.Cluster) error {
+	if name := c.MetaData.ClusterName; f.failAdd[name] > 0 {
+		f.failAdd[name]--
+		return errors.New("add failed")
+	}
+	f.added = append(f.added, c.MetaData.ClusterName)
+	return nil
+}
+
+func (f *fakeCore) UpdateCluster(c controller.Cluster) error {
+	f.updated = append(f.updated, c.MetaData.ClusterName)
+	return nil
+}
+
+func (f *fakeCore) RemoveCluster(name string, emitDelete bool) error {
+	f.removed = append(f.removed, name)
+	return nil
+}
+
+func (f *fakeCore) SetReMaxReQueueTime(n int) {
+	f.maxReQueueTime = n
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadConfig(t *testing.T, path string) *config.Config {
+	t.Helper()
+	c, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func cluster(name, env string) string {
+	return `
+  - metadata:
+      clusterName: ` + name + `
+      server: https://` + name + `.example.com
+      token: token
+      labels:
+        env: ` + env + `
+`
+}
+
+func TestReloadApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "maxRequeueTime: 3\nclusters:"+cluster("a", "dev")+cluster("b", "dev"))
+	r := newConfigReloader(path, loadConfig(t, path))
+	writeConfig(t, path, "maxRequeueTime: 5\nclusters:"+cluster("b", "prod")+cluster("c", "dev"))
+
+	core := &fakeCore{}
+	if _, err := r.apply(core, loadConfig(t, path)); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(core.added)
+	if !reflect.DeepEqual(core.added, []string{"c"}) || !reflect.DeepEqual(core.updated, []string{"b"}) ||
+		!reflect.DeepEqual(core.removed, []string{"a"}) || core.maxReQueueTime != 5 {
+		t.Fatalf("unexpected changes: %+v", core)
+	}
+}
+
+func TestReloadRejectInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "clusters:"+cluster("a", "dev"))
+	current := loadConfig(t, path)
+	r := newConfigReloader(path, current)
+	core := &fakeCore{}
+
+	// 无效配置被拒绝，继续使用旧配置，同一内容不会重复加载
+	writeConfig(t, path, "maxRequeueTime: -1\nclusters:"+cluster("b", "dev"))
+	r.check(core)
+	if r.current != current || len(core.added)+len(core.removed) != 0 {
+		t.Fatalf("invalid config should be rejected: %+v", core)
+	}
+	raw, _ := ioutil.ReadFile(path)
+	if string(r.raw) != string(raw) {
+		t.Fatal("rejected content should be recorded")
+	}
+
+	// 修正后应用
+	writeConfig(t, path, "clusters:"+cluster("b", "dev"))
+	r.check(core)
+	if r.current == current || !reflect.DeepEqual(core.added, []string{"b"}) || !reflect.DeepEqual(core.removed, []string{"a"}) {
+		t.Fatalf("fixed config should be applied: %+v", core)
+	}
+}
+
+func TestReloadRetryFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "clusters:"+cluster("a", "dev"))
+	r := newConfigReloader(path, loadConfig(t, path))
+	core := &fakeCore{failAdd: map[string]int{"c": 1}}
+
+	// 新增失败的集群不记录到当前配置
+	writeConfig(t, path, "clusters:"+cluster("a", "dev")+cluster("b", "dev")+cluster("c", "dev"))
+	r.check(core)
+	if !reflect.DeepEqual(core.added, []string{"b"}) || len(r.current.Clusters) != 2 {
+		t.Fatalf("failed cluster should be kept out of the current config: %+v", core)
+	}
+
+	// 文件未变化，下次检查时只重试失败的集群
+	r.check(core)
+	if !reflect.DeepEqual(core.added, []string{"b", "c"}) || len(r.current.Clusters) != 3 {
+		t.Fatalf("failed cluster should be retried: %+v", core)
+	}
+	r.check(core)
+	if len(core.added) != 2 {
+		t.Fatalf("applied config should not be reloaded again: %+v", core)
+	}
+}
+
+func TestReloadInclude(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	include := filepath.Join(dir, "clusters.yaml")
+	writeConfig(t, path, "include:\n  - clusters.yaml\n")
+	writeConfig(t, include, "clusters:"+cluster("a", "dev"))
+	r := newConfigReloader(path, loadConfig(t, path))
+	core := &fakeCore{}
+
+	// 只有被引入的文件变化
+	writeConfig(t, include, "clusters:"+cluster("a", "prod"))
+	r.check(core)
+	if !reflect.DeepEqual(core.updated, []string{"a"}) {
+		t.Fatalf("include change should be reloaded: %+v", core)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "clusters:"+cluster("a", "dev"))
+	old := loadConfig(t, path)
+	writeConfig(t, path, "cacheSyncTimeout: 30s\nclusterSets:\n  - selector: env=dev\n    list:\n      - rType: pods\n        namespace: default\nclusters:"+cluster("a", "prod"))
+	got := restartRequired(old, loadConfig(t, path))
+	if want := []string{"cacheSyncTimeout", "clusterSets"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
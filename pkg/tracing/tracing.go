@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName tracer 的名称
+const InstrumentationName = "github.com/practice/multi_cluster_informer"
+
+// span 属性
+const (
+	ClusterKey  = attribute.Key("multi_cluster_informer.cluster")
+	ResourceKey = attribute.Key("multi_cluster_informer.resource")
+	KeyKey      = attribute.Key("multi_cluster_informer.key")
+	EventKey    = attribute.Key("multi_cluster_informer.event")
+)
+
+// Config OTLP 导出配置，未调用 Setup 时使用 otel 全局的 no-op 实现，不需要 collector
+type Config struct {
+	// Endpoint OTLP/HTTP 地址，如 otel-collector:4318，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 环境变量或默认值
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Insecure 是否使用 http 而不是 https
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// Headers 导出请求附带的 header，如认证信息
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// ServiceName 上报的服务名，默认 multi-cluster-informer
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+	// SampleRatio 采样比例，0 到 1，默认 1 即全部采样
+	SampleRatio *float64 `json:"sampleRatio" yaml:"sampleRatio"`
+}
+
+// Setup 创建 OTLP 导出器并设置为 otel 全局的 TracerProvider 与传播器
+// 返回的 shutdown 在退出时调用，导出剩余的 span
+func Setup(ctx context.Context, c Config) (shutdown func(context.Context) error, err error) {
+	opts := []otlptracehttp.Option{}
+	if c.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+	}
+	if c.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(c.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(c.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = "multi-cluster-informer"
+	}
+	ratio := 1.0
+	if c.SampleRatio != nil {
+		ratio = *c.SampleRatio
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// Tracer 返回本项目使用的 tracer，每次从 otel 全局获取，Setup 之后创建的 span 即可导出
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+type tracerKey struct{}
+
+// NewContext 返回携带 tracer 的 ctx，中间件与 handler 通过 TracerFrom 获取
+func NewContext(ctx context.Context, tracer trace.Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// TracerFrom 返回 ctx 中的 tracer，没有时使用 otel 全局的 tracer
+func TracerFrom(ctx context.Context) trace.Tracer {
+	if tracer, ok := ctx.Value(tracerKey{}).(trace.Tracer); ok {
+		return tracer
+	}
+	return Tracer()
+}
+
+// Attributes 返回事件的 span 属性
+func Attributes(cluster, resource, key, event string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		ClusterKey.String(cluster),
+		ResourceKey.String(resource),
+		KeyKey.String(key),
+		EventKey.String(event),
+	}
+}
+
+// traceparent W3C traceparent 的传播器，只用于在 QueueObject 中保存 span context
+var traceparent = propagation.TraceContext{}
+
+// Inject 将 ctx 中的 span context 编码为 W3C traceparent，未采样或 no-op 时返回空
+// 编码为字符串是为了让 QueueObject 保持可比较，可以作为工作队列的 key
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceparent.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract 解析 Inject 编码的 traceparent，无效时返回空的 span context
+func Extract(parent string) trace.SpanContext {
+	if parent == "" {
+		return trace.SpanContext{}
+	}
+	ctx := traceparent.Extract(context.Background(), propagation.MapCarrier{"traceparent": parent})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// End 记录错误并结束 span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}